@@ -0,0 +1,39 @@
+package orderbookfetcher
+
+import "time"
+
+type AlertKind string
+
+const (
+	// one of our sell orders is no longer the cheapest
+	AlertUndercut AlertKind = "undercut"
+	// one of our buy orders is no longer the highest
+	AlertOutbid AlertKind = "outbid"
+	// the best price of a watched type moved by more than the threshold
+	AlertPriceMove AlertKind = "price_move"
+)
+
+// something on the watchlist that needs our attention
+type Alert struct {
+	Kind AlertKind `json:"kind"`
+	// expiry of the snapshot that triggered the alert
+	Time         time.Time `json:"time"`
+	LocationID   uint64    `json:"locationId"`
+	LocationName string    `json:"locationName"`
+	TypeID       int32     `json:"typeId"`
+	// our order, only set for undercut and outbid alerts
+	OrderID int64 `json:"orderId,omitempty"`
+	// is this about the buy or the sell side?
+	IsBuyOrder bool `json:"isBuyOrder"`
+	// the price of our order or the new best price
+	Price float64 `json:"price"`
+	// the price of the competing order or the previous best price
+	OtherPrice float64 `json:"otherPrice"`
+	// human readable description
+	Message string `json:"message"`
+}
+
+// delivers alerts somewhere
+type Notifier interface {
+	Notify(alert *Alert) error
+}
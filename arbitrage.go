@@ -0,0 +1,45 @@
+package orderbookfetcher
+
+import "time"
+
+// a type that can be bought at one location and sold at another for a profit
+type ArbitrageOpportunity struct {
+	TypeID int32 `json:"typeId"`
+	// where we are buying
+	From     uint64 `json:"from"`
+	FromName string `json:"fromName"`
+	// the station the sell orders are at
+	FromStation int64 `json:"fromStation"`
+	// where we are selling
+	To     uint64 `json:"to"`
+	ToName string `json:"toName"`
+	// the station we deliver to, within the range of the buy orders
+	ToStation int64 `json:"toStation"`
+	// lowest sell order at the source
+	BuyPrice float64 `json:"buyPrice"`
+	// highest buy order at the destination
+	SellPrice float64 `json:"sellPrice"`
+	// how many units can be traded at a profit?
+	Volume int64 `json:"volume"`
+	// what we pay for those units, including the broker fee
+	Cost float64 `json:"cost"`
+	// what we are left with after selling them, minus the sales tax
+	Revenue float64 `json:"revenue"`
+	// revenue - cost
+	Profit float64 `json:"profit"`
+	// profit / cost
+	Margin float64 `json:"margin"`
+}
+
+// result of the last arbitrage scan
+type ArbitrageReport struct {
+	// when was the report generated?
+	Generated time.Time `json:"generated"`
+	// sorted by profit, most profitable first
+	Opportunities []*ArbitrageOpportunity `json:"opportunities"`
+}
+
+// provides the latest arbitrage report
+type ArbitrageService interface {
+	ArbitrageReport() *ArbitrageReport
+}
@@ -0,0 +1,61 @@
+package orderbookfetcher
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+)
+
+// roles that can be given to an api key,
+// "read:<location id>" allows reading a single location
+const (
+	// everything, including the admin routes
+	RoleAdmin = "admin"
+	// every location and the global routes
+	RoleRead = "read"
+	// every region
+	RoleReadPublic = "read:public"
+	// every citadel
+	RoleReadCitadel = "read:citadel"
+)
+
+// a key that is allowed to access the api,
+// only its hash is stored so the configuration doesn't leak the key
+type APIKey struct {
+	// shows up in the access log
+	Name string `json:"name"`
+	// hex encoded sha256 of the key
+	Hash  string   `json:"hash"`
+	Roles []string `json:"roles"`
+}
+
+// hash a key the way it's stored in the configuration
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// create a new random key
+func NewAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// load the keys from a json file, which holds an array of keys
+func LoadAPIKeys(fileName string) ([]APIKey, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var keys []APIKey
+	if err = json.NewDecoder(file).Decode(&keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,37 @@
+package orderbookfetcher
+
+import "time"
+
+// open, high, low and close of a price within a bucket
+type OHLC struct {
+	Open  float64 `json:"open"`
+	High  float64 `json:"high"`
+	Low   float64 `json:"low"`
+	Close float64 `json:"close"`
+}
+
+// best prices of a single type at a location, aggregated over a time bucket
+type Candle struct {
+	// which item is this candle for?
+	TypeID int32 `json:"typeId"`
+	// region or citadel the orders were fetched from
+	LocationID uint64 `json:"locationId"`
+	// start of the bucket
+	Start time.Time `json:"start"`
+	// size of the bucket
+	Bucket Duration `json:"bucket"`
+	// highest buy order, nil if there were no buy orders in the bucket
+	Bid *OHLC `json:"bid,omitempty"`
+	// lowest sell order, nil if there were no sell orders in the bucket
+	Ask *OHLC `json:"ask,omitempty"`
+	// midpoint between bid and ask, only set while both sides exist
+	Mid *OHLC `json:"mid,omitempty"`
+	// how many snapshots went into this candle
+	Snapshots uint `json:"snapshots"`
+}
+
+// look up the stored candles of a type
+type CandleService interface {
+	// candles for the type at the location, with a start within [from, to]
+	FindCandles(location uint64, typeID int32, bucket Duration, from, to time.Time) ([]*Candle, error)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+	"github.com/SustainedCruelty/eve-orderbook-fetcher/market"
+)
+
+// run one of the subcommands instead of the fetcher
+func runCommand(name string, args []string) error {
+	switch name {
+	case "candles":
+		return runCandles(args)
+	case "key":
+		return runKey(args)
+	case "config":
+		return runConfig(args)
+	case "login":
+		return runLogin(args)
+	default:
+		return fmt.Errorf("unknown command: %s", name)
+	}
+}
+
+// work with the configuration file
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: config check|convert|init")
+	}
+	switch args[0] {
+	case "check":
+		return runConfigCheck(args[1:])
+	case "convert":
+		return runConfigConvert(args[1:])
+	case "init":
+		return runConfigInit(args[1:])
+	default:
+		return fmt.Errorf("unknown config command: %s", args[0])
+	}
+}
+
+// load the configuration and report every problem with it
+func runConfigCheck(args []string) error {
+	fs := flag.NewFlagSet("config check", flag.ExitOnError)
+	configFlags := newConfigFlags(fs)
+	fs.Parse(args)
+
+	config, err := configFlags.load()
+	if err != nil {
+		return err
+	}
+	if err = config.Validate(); err != nil {
+		return err
+	}
+	if config.Auth.KeyFile != "" {
+		keys, err := orderbookfetcher.LoadAPIKeys(config.Auth.KeyFile)
+		if err != nil {
+			return fmt.Errorf("auth.keyFile: %w", err)
+		}
+		// validate the keys from the file the same way
+		config.Auth.Keys = keys
+		if err = config.Validate(); err != nil {
+			return fmt.Errorf("in %s: %w", config.Auth.KeyFile, err)
+		}
+	}
+	fmt.Printf("the configuration is valid: %d region(s), %d citadel(s)\n", len(config.Regions), len(config.Citadels))
+	return nil
+}
+
+// translate a configuration file into another format
+func runConfigConvert(args []string) error {
+	fs := flag.NewFlagSet("config convert", flag.ExitOnError)
+	in := fs.String("in", "config.json", "configuration file to convert")
+	out := fs.String("out", "", "file to write, stdout if empty")
+	to := fs.String("to", "", "json, yaml or toml, by the extension of -out if empty")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %q, the files are given with -in and -out", fs.Args())
+	}
+
+	format := *to
+	if format == "" {
+		if *out == "" {
+			return fmt.Errorf("-to is required when writing to stdout")
+		}
+		format = orderbookfetcher.ConfigFormat(*out)
+	}
+	file, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var converted bytes.Buffer
+	if err = orderbookfetcher.ConvertConfiguration(file, orderbookfetcher.ConfigFormat(*in), &converted, format); err != nil {
+		return fmt.Errorf("failed to convert %s: %w", *in, err)
+	}
+	if *out == "" {
+		_, err = converted.WriteTo(os.Stdout)
+		return err
+	}
+	// the configuration can hold the refresh token, so it's only as readable as the original
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*out, converted.Bytes(), stat.Mode().Perm())
+}
+
+// write a commented configuration to start from
+func runConfigInit(args []string) error {
+	fs := flag.NewFlagSet("config init", flag.ExitOnError)
+	out := fs.String("out", "config.yaml", "file to write, json, yaml or toml by its extension")
+	force := fs.Bool("force", false, "overwrite the file if it exists")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %q, the file is given with -out", fs.Args())
+	}
+
+	if _, err := os.Stat(*out); err == nil && !*force {
+		return fmt.Errorf("%s already exists, use -force to overwrite it", *out)
+	}
+	var starter bytes.Buffer
+	switch format := orderbookfetcher.ConfigFormat(*out); format {
+	case orderbookfetcher.ConfigYAML:
+		starter.WriteString(starterYAML)
+	case orderbookfetcher.ConfigTOML:
+		starter.WriteString(starterTOML)
+	default:
+		if err := orderbookfetcher.ConvertConfiguration(strings.NewReader(starterYAML), orderbookfetcher.ConfigYAML, &starter, format); err != nil {
+			return err
+		}
+	}
+	// only readable by the owner, the refresh token goes in there
+	if err := os.WriteFile(*out, starter.Bytes(), 0600); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s, check it with: orderbook-fetcher config check -config %s\n", *out, *out)
+	return nil
+}
+
+// create a new api key and print its configuration entry
+func runKey(args []string) error {
+	fs := flag.NewFlagSet("key", flag.ExitOnError)
+	name := fs.String("name", "", "name of the key, shows up in the access log")
+	roles := fs.String("roles", orderbookfetcher.RoleRead, "comma separated roles (admin, read, read:public, read:citadel, read:<location id>)")
+	fs.Parse(args)
+
+	if *name == "" {
+		return fmt.Errorf("-name is required")
+	}
+	key, err := orderbookfetcher.NewAPIKey()
+	if err != nil {
+		return err
+	}
+	entry, err := json.MarshalIndent(orderbookfetcher.APIKey{
+		Name:  *name,
+		Hash:  orderbookfetcher.HashAPIKey(key),
+		Roles: strings.Split(*roles, ","),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("key: %s\n\nadd this to auth.keys or the key file:\n%s\n", key, entry)
+	return nil
+}
+
+// print the stored candles of a type
+func runCandles(args []string) error {
+	fs := flag.NewFlagSet("candles", flag.ExitOnError)
+	configFlags := newConfigFlags(fs)
+	location := fs.Uint64("location", 0, "region or citadel id")
+	typeID := fs.Int("type", 0, "type id")
+	bucketFlag := fs.String("bucket", "1h", "bucket size (5m, 1h, 1d, ...)")
+	fromFlag := fs.String("from", "", "start of the time range (RFC 3339), defaults to one day before -to")
+	toFlag := fs.String("to", "", "end of the time range (RFC 3339), defaults to now")
+	asJSON := fs.Bool("json", false, "print the candles as json")
+	fs.Parse(args)
+
+	if *location == 0 || *typeID == 0 {
+		return fmt.Errorf("-location and -type are required")
+	}
+	bucket, err := orderbookfetcher.ParseDuration(*bucketFlag)
+	if err != nil {
+		return err
+	}
+	to := time.Now()
+	if *toFlag != "" {
+		if to, err = time.Parse(time.RFC3339, *toFlag); err != nil {
+			return err
+		}
+	}
+	from := to.Add(-24 * time.Hour)
+	if *fromFlag != "" {
+		if from, err = time.Parse(time.RFC3339, *fromFlag); err != nil {
+			return err
+		}
+	}
+
+	config, err := configFlags.load()
+	if err != nil {
+		return err
+	}
+	store := market.NewCandleStore(filepath.Join(config.DataDirectory, "candles"), config.CandleBuckets)
+	candles, err := store.FindCandles(*location, int32(*typeID), bucket, from, to)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(candles)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "START\tBID O/H/L/C\tASK O/H/L/C\tMID O/H/L/C\tSNAPSHOTS")
+	for _, candle := range candles {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n",
+			candle.Start.Format(time.RFC3339),
+			formatOHLC(candle.Bid),
+			formatOHLC(candle.Ask),
+			formatOHLC(candle.Mid),
+			candle.Snapshots,
+		)
+	}
+	return w.Flush()
+}
+
+func formatOHLC(ohlc *orderbookfetcher.OHLC) string {
+	if ohlc == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f/%.2f/%.2f/%.2f", ohlc.Open, ohlc.High, ohlc.Low, ohlc.Close)
+}
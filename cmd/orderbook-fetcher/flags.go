@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// where the configuration comes from: the file, the EOBF_* environment variables
+// and a flag per option, applied in that order (flags > environment > file)
+type configFlags struct {
+	// the configuration file, none if empty
+	file string
+	// options set on the command line by name
+	overrides map[string]string
+}
+
+// register -config and a flag for every option of the configuration ("-server.listen")
+func newConfigFlags(fs *flag.FlagSet) *configFlags {
+	f := &configFlags{overrides: make(map[string]string)}
+	file := "config.json"
+	if env, ok := os.LookupEnv(orderbookfetcher.ConfigFileEnv); ok {
+		file = env
+	}
+	fs.StringVar(&f.file, "config", file, "path to the configuration file, none if empty ($"+orderbookfetcher.ConfigFileEnv+")")
+	for _, option := range orderbookfetcher.ConfigOptions() {
+		fs.Var(&optionFlag{name: option.Name, overrides: f.overrides}, option.Name,
+			fmt.Sprintf("overrides %s of the configuration file ($%s)", option.Name, option.Env))
+	}
+	return f
+}
+
+// load the configuration file and apply the environment and the flags on top of it
+func (f *configFlags) load() (*orderbookfetcher.Configuration, error) {
+	config, err := orderbookfetcher.LoadConfiguration(f.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the configuration: %w", err)
+	}
+	if err = config.ApplyEnvironment(os.Environ()); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(f.overrides))
+	for name := range f.overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = config.Set(name, f.overrides[name]); err != nil {
+			return nil, fmt.Errorf("-%w", err)
+		}
+	}
+	return config, nil
+}
+
+// remembers the value of an option flag, it's applied once the file has been loaded
+type optionFlag struct {
+	name      string
+	overrides map[string]string
+}
+
+func (o *optionFlag) String() string {
+	if o == nil || o.overrides == nil {
+		return ""
+	}
+	return o.overrides[o.name]
+}
+
+func (o *optionFlag) Set(value string) error {
+	o.overrides[o.name] = value
+	return nil
+}
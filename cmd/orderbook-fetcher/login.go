@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+	"github.com/SustainedCruelty/eve-orderbook-fetcher/esi"
+)
+
+// how long we wait for the user to log in
+const loginTimeout = 5 * time.Minute
+
+// log a character in through sso and put its tokens into the token store
+func runLogin(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	configFlags := newConfigFlags(fs)
+	callback := fs.String("callback", "http://localhost:8081/callback", "callback url of the esi application, it's served while logging in")
+	open := fs.Bool("open", false, "open the login page in the browser")
+	fs.Parse(args)
+
+	config, err := configFlags.load()
+	if err != nil {
+		return err
+	}
+	if config.ClientID == "" {
+		return fmt.Errorf("clientId is required to log in")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), loginTimeout)
+	defer cancel()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	login := esi.NewLogin(config.SSOURL, config.ClientID, *callback)
+	login.OpenURL = func(authorizeURL string) {
+		fmt.Printf("log in at:\n%s\n", authorizeURL)
+		if *open {
+			if err := openBrowser(authorizeURL); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to open the browser: %s\n", err)
+			}
+		}
+	}
+	token, err := login.Run(ctx)
+	if err != nil {
+		return err
+	}
+	// takes precedence over the refresh token in the configuration until that changes
+	token.ConfigToken = orderbookfetcher.HashRefreshToken(config.RefreshToken)
+	fileName := config.TokenFileName()
+	if err = esi.NewFileTokenStore(fileName).SaveToken(token); err != nil {
+		return fmt.Errorf("failed to store the token: %w", err)
+	}
+	fmt.Printf("the token has been written to %s\n", fileName)
+	return nil
+}
+
+// open the url with the default browser of the platform
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
@@ -2,17 +2,32 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
 
 	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
 	"github.com/SustainedCruelty/eve-orderbook-fetcher/esi"
 	"github.com/SustainedCruelty/eve-orderbook-fetcher/http"
+	"github.com/SustainedCruelty/eve-orderbook-fetcher/market"
+	"github.com/SustainedCruelty/eve-orderbook-fetcher/notify"
 )
 
 func main() {
+	// run a subcommand instead of the fetcher if one was given
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// used to terminate execution
 	ctx, cancel := context.WithCancel(context.Background())
 	// cancel the context if the program is terminated
@@ -20,15 +35,22 @@ func main() {
 	signal.Notify(c, os.Interrupt)
 	go func() { <-c; cancel() }()
 
-	// load our config file
-	config, err := orderbookfetcher.LoadConfiguration("config.json")
+	// load our config file, with the environment and flags applied
+	configFlags := newConfigFlags(flag.CommandLine)
+	flag.Parse()
+	config, err := configFlags.load()
 	if err != nil {
-		log.Fatalf("failed to load the configuration: %s", err)
+		log.Fatal(err)
+	}
+	if err = config.Validate(); err != nil {
+		log.Fatal(err)
 	}
 
 	log.Printf("fetching %d citadel(s) and %d regions(s)", len(config.Citadels), len(config.Regions))
 
 	m := NewMain(config)
+	m.ConfigFile = configFlags.file
+	m.LoadConfiguration = configFlags.load
 
 	// start the server + fetcher
 	if err := m.Run(ctx); err != nil {
@@ -49,37 +71,136 @@ func main() {
 type Main struct {
 	// config file
 	Configuration *orderbookfetcher.Configuration
+	// where the configuration has been loaded from, watched for changes if set
+	ConfigFile string
+	// loads the configuration again on reload, with the overrides applied
+	LoadConfiguration func() (*orderbookfetcher.Configuration, error)
 	// fetches the orderbooks
 	Fetcher *esi.Fetcher
 	// serves a small ui
 	Server *http.Server
+	// aggregates the best prices into candles
+	Candles *market.CandleStore
+	// follows the orders across snapshots
+	Lifecycles *market.LifecycleTracker
+	// looks for price differences between locations
+	Arbitrage *market.ArbitrageScanner
+	// calculates the station trading margins
+	Margins *market.MarginCalculator
+	// sends alerts about the watchlist
+	Alerts *market.AlertWatcher
+	// posts the fetcher events to webhooks
+	Webhooks *notify.WebhookDispatcher
+	// tells the chat channels about failures
+	Chats []*notify.Chat
 }
 
 // construct a new main object that holds our instances
 func NewMain(config *orderbookfetcher.Configuration) *Main {
+	lifecycles := market.NewLifecycleTracker(filepath.Join(config.DataDirectory, "orders"))
+	chats := make([]*notify.Chat, len(config.Chat))
+	for i, chat := range config.Chat {
+		chats[i] = notify.NewChat(chat)
+	}
+	fetcher := esi.NewFetcher(config)
+	fetcher.TokenStore = esi.NewFileTokenStore(config.TokenFileName())
+	webhooks := notify.NewWebhookDispatcher(filepath.Join(config.DataDirectory, "outbox"), config.PublicURL, config.Webhooks, config.Alerts.Webhooks)
 	return &Main{
 		Configuration: config,
-		Fetcher:       esi.NewFetcher(config),
-		Server:        http.NewServer(),
+		Fetcher:       fetcher,
+		Server:        newServer(config.Server, config.Auth, config.OrderbookDirectory),
+		Candles:       market.NewCandleStore(filepath.Join(config.DataDirectory, "candles"), config.CandleBuckets),
+		Lifecycles:    lifecycles,
+		Arbitrage:     market.NewArbitrageScanner(filepath.Join(config.DataDirectory, "reports", "arbitrage.csv"), config.Fees, config.Arbitrage),
+		Margins:       market.NewMarginCalculator(config.Fees, config.StationTrading, lifecycles),
+		Alerts:        market.NewAlertWatcher(config.Watchlist, newAlertNotifier(config.Alerts, chats, webhooks)),
+		Webhooks:      webhooks,
+		Chats:         chats,
 	}
 }
 
+// construct the http server from the configuration
+func newServer(config orderbookfetcher.ServerConfig, auth orderbookfetcher.AuthConfig, orderbooks string) *http.Server {
+	server := http.NewServer()
+	server.OrderbookDirectory = orderbooks
+	server.Listen = config.Listen
+	server.TLSCertFile = config.TLSCert
+	server.TLSKeyFile = config.TLSKey
+	server.ReadTimeout = time.Duration(config.ReadTimeout)
+	server.WriteTimeout = time.Duration(config.WriteTimeout)
+	server.IdleTimeout = time.Duration(config.IdleTimeout)
+	server.AdminListen = config.AdminListen
+	server.APIKeys = append(server.APIKeys, auth.Keys...)
+	server.AccessLogFile = auth.AccessLog
+	return server
+}
+
+// send the alerts to every configured destination
+func newAlertNotifier(config orderbookfetcher.AlertConfig, chats []*notify.Chat, webhooks *notify.WebhookDispatcher) orderbookfetcher.Notifier {
+	var notifiers notify.Multi
+	for _, chat := range chats {
+		notifiers = append(notifiers, chat)
+	}
+	if len(config.Webhooks) > 0 {
+		notifiers = append(notifiers, webhooks)
+	}
+	if config.LogFile != "" {
+		notifiers = append(notifiers, notify.NewLogFile(config.LogFile))
+	}
+	return notifiers
+}
+
 // run our services and inject the dependencies
 func (m *Main) Run(ctx context.Context) error {
 	log.Println("running...")
+	m.Fetcher.AddSnapshotHandler(m.Candles)
+	m.Fetcher.AddSnapshotHandler(m.Lifecycles)
+	m.Fetcher.AddSnapshotHandler(m.Arbitrage)
+	// has to come after the lifecycles, so the daily volumes are up to date
+	m.Fetcher.AddSnapshotHandler(m.Margins)
+	m.Fetcher.AddSnapshotHandler(m.Alerts)
+	if len(m.Configuration.Webhooks) > 0 || len(m.Configuration.Alerts.Webhooks) > 0 {
+		if err := m.Webhooks.Start(); err != nil {
+			return err
+		}
+		m.Fetcher.AddEventHandler(m.Webhooks)
+	}
+	for _, chat := range m.Chats {
+		m.Fetcher.AddEventHandler(chat)
+	}
+	// drop the books and reports of removed locations
+	m.Fetcher.AddEventHandler(m.Arbitrage)
+	m.Fetcher.AddEventHandler(m.Margins)
+	m.Fetcher.AddEventHandler(m.Server.Events)
 	if err := m.Fetcher.Start(); err != nil {
 		return err
 	}
 	m.Server.ESIFetcher = m.Fetcher
+	m.Server.CandleService = m.Candles
+	m.Server.ArbitrageService = m.Arbitrage
+	m.Server.MarginService = m.Margins
+	if m.Configuration.Auth.KeyFile != "" {
+		keys, err := orderbookfetcher.LoadAPIKeys(m.Configuration.Auth.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load the api keys: %w", err)
+		}
+		m.Server.APIKeys = append(m.Server.APIKeys, keys...)
+	}
 	if err := m.Server.Open(); err != nil {
 		return err
 	}
+	if m.ConfigFile != "" {
+		go m.watchConfiguration(ctx)
+	}
 	return nil
 }
 
 // graceful shutdown
 func (m *Main) Close() error {
 	m.Fetcher.Shutdown()
+	// the alerts can still go to the webhooks and the log file
+	m.Alerts.Shutdown()
+	m.Webhooks.Shutdown()
 	if err := m.Server.Close(); err != nil {
 		return err
 	}
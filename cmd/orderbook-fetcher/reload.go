@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// how often the configuration file is checked for changes
+const configPollInterval = 5 * time.Second
+
+// reload the configuration on SIGHUP or when the file changes, until the context is cancelled
+func (m *Main) watchConfiguration(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	modified := modTime(m.ConfigFile)
+	for {
+		select {
+		case <-hup:
+			log.Println("received SIGHUP, reloading the configuration")
+			modified = modTime(m.ConfigFile)
+			m.reload()
+		case <-ticker.C:
+			if t := modTime(m.ConfigFile); !t.Equal(modified) {
+				modified = t
+				log.Println("configuration file changed, reloading")
+				m.reload()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// load the configuration file again and apply it to the fetcher,
+// the running configuration is kept if the new one is invalid
+func (m *Main) reload() {
+	config, err := m.LoadConfiguration()
+	if err == nil {
+		err = config.Validate()
+	}
+	if err != nil {
+		log.Printf("keeping the running configuration, the new one is invalid: %s", err)
+		return
+	}
+	if err = m.Fetcher.Reload(config); err != nil {
+		log.Printf("keeping the running configuration, failed to apply the new one: %s", err)
+	}
+}
+
+// when was the file last modified? zero if it can't be read
+func modTime(fileName string) time.Time {
+	stat, err := os.Stat(fileName)
+	if err != nil {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
@@ -0,0 +1,120 @@
+package main
+
+// written by config init, the json starter is converted from the yaml one as json can't hold comments
+const starterYAML = `# orderbook-fetcher configuration
+# check it with: orderbook-fetcher config check -config config.yaml
+# every option can be overridden with a flag (-server.listen :9000)
+# or an environment variable (EOBF_SERVER_LISTEN=:9000)
+
+# regions to fetch, either a plain id or an object overriding the options below:
+#   - id: 10000002
+#     name: The Forge
+#     interval: 3
+#     format: csv.gz        # csv (default) or csv.gz
+#     directory: orderbooks/jita
+#     types: [34, 35, 36]  # only write the orders of these types
+regions:
+  - 10000002 # The Forge
+# citadels to fetch, they require clientId and refreshToken
+citadels: []
+
+# fetch every n orderbooks, esi refreshes them every 5 minutes
+interval: 1
+# how many orderbooks to keep per location, all of them if 0
+retentionPeriod: 0
+retention:
+  # delete orderbooks that are older than this
+  maxAge: 30d
+  # disk budget of each location and of all of them together, unlimited if 0
+  locationMaxBytes: 0
+  maxBytes: 0
+  # keep one orderbook per hour after a day and one per day after a month
+  downsample: false
+
+# where the orderbooks and everything else (candles etc.) are written to
+orderbookDirectory: orderbooks
+dataDirectory: data
+
+# esi application and refresh token of the character, only needed for citadels.
+# keep the token out of here with EOBF_REFRESH_TOKEN_FILE=/run/secrets/refresh_token
+clientId: ""
+refreshToken: ""
+
+server:
+  # "host:port" or "unix:/path/to/socket"
+  listen:
+    - ":8080"
+  # serve https
+  tlsCert: ""
+  tlsKey: ""
+  # pprof, don't make it reachable from the outside
+  adminListen: ""
+
+auth:
+  # create keys with: orderbook-fetcher key -name someone -roles read
+  # authentication is disabled if there are none
+  keys: []
+  accessLog: ""
+
+# url the api is reachable at, used for the download links
+publicUrl: http://localhost:8080
+# how many intervals the newest orderbook may be behind before /readyz fails
+staleness: 3
+`
+
+const starterTOML = `# orderbook-fetcher configuration
+# check it with: orderbook-fetcher config check -config config.toml
+# every option can be overridden with a flag (-server.listen :9000)
+# or an environment variable (EOBF_SERVER_LISTEN=:9000)
+
+# regions to fetch, either a plain id or a table overriding the options below:
+#   { id = 10000002, name = "The Forge", interval = 3, format = "csv.gz", types = [34, 35, 36] }
+regions = [
+  10000002, # The Forge
+]
+# citadels to fetch, they require clientId and refreshToken
+citadels = []
+
+# fetch every n orderbooks, esi refreshes them every 5 minutes
+interval = 1
+# how many orderbooks to keep per location, all of them if 0
+retentionPeriod = 0
+
+# where the orderbooks and everything else (candles etc.) are written to
+orderbookDirectory = "orderbooks"
+dataDirectory = "data"
+
+# esi application and refresh token of the character, only needed for citadels.
+# keep the token out of here with EOBF_REFRESH_TOKEN_FILE=/run/secrets/refresh_token
+clientId = ""
+refreshToken = ""
+
+# url the api is reachable at, used for the download links
+publicUrl = "http://localhost:8080"
+# how many intervals the newest orderbook may be behind before /readyz fails
+staleness = 3
+
+[retention]
+# delete orderbooks that are older than this
+maxAge = "30d"
+# disk budget of each location and of all of them together, unlimited if 0
+locationMaxBytes = 0
+maxBytes = 0
+# keep one orderbook per hour after a day and one per day after a month
+downsample = false
+
+[server]
+# "host:port" or "unix:/path/to/socket"
+listen = [":8080"]
+# serve https
+tlsCert = ""
+tlsKey = ""
+# pprof, don't make it reachable from the outside
+adminListen = ""
+
+[auth]
+# create keys with: orderbook-fetcher key -name someone -roles read
+# authentication is disabled if there are none
+keys = []
+accessLog = ""
+`
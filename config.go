@@ -1,35 +1,238 @@
 package orderbookfetcher
 
 import (
-	"encoding/json"
 	"os"
+	"path/filepath"
+	"time"
 )
 
 type Configuration struct {
 	// how many orderbooks are we saving on disk (per location)
 	RetentionPeriod uint `json:"retentionPeriod"`
+	// age, disk budget and downsampling of the orderbooks on disk
+	Retention RetentionConfig `json:"retention"`
 	// how often are we fetching?
 	Interval uint `json:"interval"`
 	// what regions are we fetching?
-	Regions []uint64 `json:"regions"`
+	Regions []LocationConfig `json:"regions"`
 	// what citadels are we fetching?
-	Citadels []uint64 `json:"citadels"`
+	Citadels []LocationConfig `json:"citadels"`
+	// where the orderbooks are written to (default "orderbooks")
+	OrderbookDirectory string `json:"orderbookDirectory"`
 	// client id for the esi application
 	ClientID string `json:"clientId"`
+	// base url of the eve sso (default "https://login.eveonline.com")
+	SSOURL string `json:"ssoUrl"`
+	// keys the access tokens are verified with (default "https://login.eveonline.com/oauth/jwks")
+	JWKSURL string `json:"jwksUrl"`
 	// refresh token to retrieve our access token
 	RefreshToken string `json:"refreshToken"`
+	// where the latest tokens are kept between runs (default {dataDirectory}/token.json),
+	// a refresh token in there takes precedence over the one above
+	TokenFile string `json:"tokenFile"`
+	// where do we keep state that isn't an orderbook (candles etc.)?
+	DataDirectory string `json:"dataDirectory"`
+	// bucket sizes of the price candles we are aggregating
+	CandleBuckets []Duration `json:"candleBuckets"`
+	// fees that get deducted when calculating profits
+	Fees Fees `json:"fees"`
+	// what counts as an arbitrage opportunity?
+	Arbitrage ArbitrageConfig `json:"arbitrage"`
+	// what counts as a station trading opportunity?
+	StationTrading StationTradingConfig `json:"stationTrading"`
+	// orders and types we want to be alerted about
+	Watchlist []WatchlistEntry `json:"watchlist"`
+	// where the alerts get sent
+	Alerts AlertConfig `json:"alerts"`
+	// urls that get notified about new orderbooks and failures
+	Webhooks []WebhookConfig `json:"webhooks"`
+	// url the api is reachable at from the outside, used to build download links
+	PublicURL string `json:"publicUrl"`
+	// discord or slack channels that get told about failures and alerts
+	Chat []ChatConfig `json:"chat"`
+	// where and how the api is served
+	Server ServerConfig `json:"server"`
+	// who is allowed to access the api
+	Auth AuthConfig `json:"auth"`
+	// how many intervals may the newest orderbook of a location be behind
+	// before the fetcher isn't considered ready anymore (default 3)
+	Staleness float64 `json:"staleness"`
 }
 
-// load a configuration from a text file
+// applied by the janitor to every orderbook on disk, including the ones of previous runs.
+// the newest orderbook of a location is always kept
+type RetentionConfig struct {
+	// delete orderbooks that expired longer ago than this, kept forever if zero
+	MaxAge Duration `json:"maxAge"`
+	// disk budget of each location, unlimited if zero
+	LocationMaxBytes ByteSize `json:"locationMaxBytes"`
+	// disk budget of all orderbooks together, unlimited if zero
+	MaxBytes ByteSize `json:"maxBytes"`
+	// keep one orderbook per hour after a day and one per day after a month
+	Downsample bool `json:"downsample"`
+	// how often the janitor runs (default 10m)
+	Interval Duration `json:"interval"`
+}
+
+type Fees struct {
+	// broker fee charged on the purchase (0.015 = 1.5%)
+	BrokerFee float64 `json:"brokerFee"`
+	// sales tax charged on the sale (0.036 = 3.6%)
+	SalesTax float64 `json:"salesTax"`
+}
+
+type ArbitrageConfig struct {
+	// which locations are we comparing? all fetched locations if empty
+	Locations []uint64 `json:"locations"`
+	// minimum profit of an opportunity (after fees)
+	MinProfit float64 `json:"minProfit"`
+	// minimum amount of units that can be traded at a profit
+	MinVolume int64 `json:"minVolume"`
+}
+
+type StationTradingConfig struct {
+	// minimum margin after fees (0.1 = 10%)
+	MinMargin float64 `json:"minMargin"`
+	// orders within this fraction of the best price count as competition (0.01 = 1%)
+	CompetitionBand float64 `json:"competitionBand"`
+}
+
+type WatchlistEntry struct {
+	// region or citadel the orders are fetched from
+	Location uint64 `json:"location"`
+	// types whose best prices we're watching
+	Types []int32 `json:"types"`
+	// our own orders, we get alerted when they are undercut or outbid
+	Orders []int64 `json:"orders"`
+	// relative change of a best price that triggers an alert (0.05 = 5%), no price alerts if zero
+	Threshold float64 `json:"threshold"`
+}
+
+type AlertConfig struct {
+	// urls the alerts get posted to as json
+	Webhooks []string `json:"webhooks"`
+	// file the alerts get appended to
+	LogFile string `json:"logFile"`
+}
+
+type WebhookConfig struct {
+	// where the events get posted to
+	URL string `json:"url"`
+	// used to sign the payload with HMAC-SHA256, unsigned if empty
+	Secret string `json:"secret"`
+	// which events are we sending? all of them if empty
+	Events []EventType `json:"events"`
+}
+
+type ChatConfig struct {
+	// incoming webhook url of the channel
+	URL string `json:"url"`
+	// "discord" or "slack", guessed from the url if empty
+	Format string `json:"format"`
+	// minimum time between two posts, messages in between are sent together with the next post (default 1m)
+	MinInterval Duration `json:"minInterval"`
+	// the same failure of a location is only reported once within this window (default 1h)
+	DedupeWindow Duration `json:"dedupeWindow"`
+}
+
+type ServerConfig struct {
+	// addresses to listen on, "host:port" or "unix:/path/to/socket" (default ":8080")
+	Listen []string `json:"listen"`
+	// serve https with this certificate and key, reloaded when the files change
+	TLSCert string `json:"tlsCert"`
+	TLSKey  string `json:"tlsKey"`
+	// limits on reading a request and writing a response, the event stream isn't limited (defaults 1m, none, 2m).
+	// a write timeout also cuts off downloads of large orderbooks over slow connections
+	ReadTimeout  Duration `json:"readTimeout"`
+	WriteTimeout Duration `json:"writeTimeout"`
+	IdleTimeout  Duration `json:"idleTimeout"`
+	// address of the admin listener serving pprof, disabled if empty
+	AdminListen string `json:"adminListen"`
+}
+
+type AuthConfig struct {
+	// keys that may access the api, authentication is disabled if there are none (in here and in the key file)
+	Keys []APIKey `json:"keys"`
+	// json file with more keys
+	KeyFile string `json:"keyFile"`
+	// file the access log is appended to, the regular log if empty
+	AccessLog string `json:"accessLog"`
+}
+
+// load a configuration from a json, yaml or toml file (by extension), without a file name
+// everything is left at the defaults (for configuring through the environment)
 func LoadConfiguration(fileName string) (*Configuration, error) {
+	if fileName == "" {
+		config := &Configuration{}
+		config.setDefaults()
+		return config, nil
+	}
 	file, err := os.Open(fileName)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
-	var config *Configuration
-	if err = json.NewDecoder(file).Decode(&config); err != nil {
+	config, err := DecodeConfiguration(file, ConfigFormat(fileName))
+	if err != nil {
 		return nil, err
 	}
+	config.setDefaults()
 	return config, nil
 }
+
+// where the tokens are kept
+func (c *Configuration) TokenFileName() string {
+	if c.TokenFile != "" {
+		return c.TokenFile
+	}
+	return filepath.Join(c.DataDirectory, "token.json")
+}
+
+// fill in the options that have been left out of the file
+func (c *Configuration) setDefaults() {
+	if c.DataDirectory == "" {
+		c.DataDirectory = "data"
+	}
+	if c.OrderbookDirectory == "" {
+		c.OrderbookDirectory = "orderbooks"
+	}
+	if c.SSOURL == "" {
+		c.SSOURL = "https://login.eveonline.com"
+	}
+	if c.JWKSURL == "" {
+		c.JWKSURL = "https://login.eveonline.com/oauth/jwks"
+	}
+	if c.PublicURL == "" {
+		c.PublicURL = "http://localhost:8080"
+	}
+	if len(c.Server.Listen) == 0 {
+		c.Server.Listen = []string{":8080"}
+	}
+	if c.Server.ReadTimeout == 0 {
+		c.Server.ReadTimeout = Duration(time.Minute)
+	}
+	if c.Server.IdleTimeout == 0 {
+		c.Server.IdleTimeout = Duration(2 * time.Minute)
+	}
+	if c.Staleness == 0 {
+		c.Staleness = 3
+	}
+	if c.Retention.Interval == 0 {
+		c.Retention.Interval = Duration(10 * time.Minute)
+	}
+	for i := range c.Chat {
+		if c.Chat[i].MinInterval == 0 {
+			c.Chat[i].MinInterval = Duration(time.Minute)
+		}
+		if c.Chat[i].DedupeWindow == 0 {
+			c.Chat[i].DedupeWindow = Duration(time.Hour)
+		}
+	}
+	if c.CandleBuckets == nil {
+		c.CandleBuckets = []Duration{
+			Duration(5 * time.Minute),
+			Duration(time.Hour),
+			Duration(24 * time.Hour),
+		}
+	}
+}
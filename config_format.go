@@ -0,0 +1,142 @@
+package orderbookfetcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// formats the configuration can be written in
+const (
+	ConfigJSON = "json"
+	ConfigYAML = "yaml"
+	ConfigTOML = "toml"
+)
+
+// the format of a configuration file by its extension, json if it's unknown
+func ConfigFormat(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".yaml", ".yml":
+		return ConfigYAML
+	case ".toml":
+		return ConfigTOML
+	}
+	return ConfigJSON
+}
+
+// decode a configuration, yaml and toml follow the same schema as json
+func DecodeConfiguration(r io.Reader, format string) (*Configuration, error) {
+	var config *Configuration
+	if format == ConfigJSON {
+		if err := json.NewDecoder(r).Decode(&config); err != nil {
+			return nil, err
+		}
+		return config, nil
+	}
+	options, err := decodeConfigMap(r, format)
+	if err != nil {
+		return nil, err
+	}
+	if config, err = configFromMap(options); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// translate a configuration into another format. it only has to fit the schema,
+// the options are written as they are, without the defaults
+func ConvertConfiguration(r io.Reader, from string, w io.Writer, to string) error {
+	options, err := decodeConfigMap(r, from)
+	if err != nil {
+		return err
+	}
+	if _, err = configFromMap(options); err != nil {
+		return err
+	}
+	switch to {
+	case ConfigJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(options)
+	case ConfigYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err = encoder.Encode(options); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case ConfigTOML:
+		return toml.NewEncoder(w).Encode(options)
+	}
+	return fmt.Errorf("unknown configuration format %q", to)
+}
+
+// decode a configuration file into plain maps, lists and values
+func decodeConfigMap(r io.Reader, format string) (map[string]any, error) {
+	options := make(map[string]any)
+	switch format {
+	case ConfigJSON:
+		decoder := json.NewDecoder(r)
+		// keeps the ids from turning into floats
+		decoder.UseNumber()
+		if err := decoder.Decode(&options); err != nil {
+			return nil, err
+		}
+	case ConfigYAML:
+		// an empty file is an empty configuration
+		if err := yaml.NewDecoder(r).Decode(&options); err != nil && err != io.EOF {
+			return nil, err
+		}
+	case ConfigTOML:
+		if _, err := toml.NewDecoder(r).Decode(&options); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown configuration format %q", format)
+	}
+	return normalizeConfigValue(options).(map[string]any), nil
+}
+
+// decode the plain maps into the configuration the same way as a json file
+func configFromMap(options map[string]any) (*Configuration, error) {
+	data, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	var config *Configuration
+	if err = json.NewDecoder(bytes.NewReader(data)).Decode(&config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// json numbers become ints or floats and nulls are dropped, which every format can encode
+func normalizeConfigValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, element := range v {
+			if element == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = normalizeConfigValue(element)
+		}
+	case []any:
+		for i, element := range v {
+			v[i] = normalizeConfigValue(element)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
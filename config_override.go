@@ -0,0 +1,165 @@
+package orderbookfetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// prefix of the environment variables that override the configuration
+	EnvPrefix = "EOBF_"
+	// path to the configuration file, when it isn't given as a flag
+	ConfigFileEnv = EnvPrefix + "CONFIG"
+	// suffix of the variables holding the path of a file the value is read from (docker/kubernetes secrets)
+	envFileSuffix = "_FILE"
+)
+
+// an option of the configuration that can be overridden by a flag or an environment variable
+type ConfigOption struct {
+	// path of the option, e.g. "server.listen"
+	Name string
+	// variable overriding it, e.g. "EOBF_SERVER_LISTEN"
+	Env string
+	// indexes of the fields leading to the option
+	index []int
+}
+
+// every option of the configuration, sorted by name
+func ConfigOptions() []ConfigOption {
+	options := configOptions(reflect.TypeOf(Configuration{}), "", nil)
+	sort.Slice(options, func(i, j int) bool { return options[i].Name < options[j].Name })
+	return options
+}
+
+// walk the struct, anything that isn't a plain struct is an option
+func configOptions(t reflect.Type, prefix string, index []int) []ConfigOption {
+	unmarshaler := reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	var options []ConfigOption
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		name = prefix + name
+		fieldIndex := append(append([]int(nil), index...), i)
+		if field.Type.Kind() == reflect.Struct && !reflect.PtrTo(field.Type).Implements(unmarshaler) {
+			options = append(options, configOptions(field.Type, name+".", fieldIndex)...)
+			continue
+		}
+		options = append(options, ConfigOption{Name: name, Env: envName(name), index: fieldIndex})
+	}
+	return options
+}
+
+// "server.tlsCert" becomes "EOBF_SERVER_TLS_CERT"
+func envName(name string) string {
+	var b strings.Builder
+	b.WriteString(EnvPrefix)
+	var previous rune
+	for _, r := range name {
+		switch {
+		case r == '.':
+			b.WriteRune('_')
+		case unicode.IsUpper(r) && (unicode.IsLower(previous) || unicode.IsDigit(previous)):
+			b.WriteRune('_')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+		previous = r
+	}
+	return b.String()
+}
+
+// override an option by its name ("server.listen"). lists are comma separated
+// or json, everything else that isn't a string is parsed like in the configuration file
+func (c *Configuration) Set(name, value string) error {
+	for _, option := range ConfigOptions() {
+		if option.Name == name {
+			if err := setConfigValue(reflect.ValueOf(c).Elem().FieldByIndex(option.index), value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			// an empty value means the default, new list entries need theirs too
+			c.setDefaults()
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown option %q", name)
+}
+
+func setConfigValue(v reflect.Value, value string) error {
+	trimmed := strings.TrimSpace(value)
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+		return nil
+	case v.Kind() == reflect.Slice && !strings.HasPrefix(trimmed, "["):
+		// an empty value clears the list
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		if trimmed != "" {
+			for _, part := range strings.Split(trimmed, ",") {
+				element := reflect.New(v.Type().Elem()).Elem()
+				if err := setConfigValue(element, strings.TrimSpace(part)); err != nil {
+					return err
+				}
+				list = reflect.Append(list, element)
+			}
+		}
+		v.Set(list)
+		return nil
+	}
+	// numbers, bools and json are decoded as they are, everything else (durations, sizes) as a json string
+	target := reflect.New(v.Type())
+	if err := json.Unmarshal([]byte(trimmed), target.Interface()); err != nil {
+		quoted, _ := json.Marshal(trimmed)
+		if json.Unmarshal(quoted, target.Interface()) != nil {
+			return fmt.Errorf("invalid value %q", value)
+		}
+	}
+	v.Set(target.Elem())
+	return nil
+}
+
+// override the options with the EOBF_* variables of the environment (os.Environ()).
+// EOBF_<OPTION>_FILE reads the value from a file instead, for secrets
+func (c *Configuration) ApplyEnvironment(environ []string) error {
+	options := make(map[string]string)
+	for _, option := range ConfigOptions() {
+		options[option.Env] = option.Name
+	}
+	var errs ConfigErrors
+	for _, variable := range environ {
+		key, value, _ := strings.Cut(variable, "=")
+		if !strings.HasPrefix(key, EnvPrefix) || key == ConfigFileEnv {
+			continue
+		}
+		name, ok := options[key]
+		if !ok && strings.HasSuffix(key, envFileSuffix) {
+			if name, ok = options[strings.TrimSuffix(key, envFileSuffix)]; ok {
+				content, err := os.ReadFile(value)
+				if err != nil {
+					errs = append(errs, &ConfigError{Field: key, Message: err.Error()})
+					continue
+				}
+				value = strings.TrimRight(string(content), "\r\n")
+			}
+		}
+		if !ok {
+			errs = append(errs, &ConfigError{Field: key, Message: "unknown environment variable"})
+			continue
+		}
+		if err := c.Set(name, value); err != nil {
+			errs = append(errs, &ConfigError{Field: key, Message: err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
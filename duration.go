@@ -0,0 +1,61 @@
+package orderbookfetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// time.Duration that can be read from and written to the configuration
+// as a string like "5m", "1h" or "1d"
+type Duration time.Duration
+
+// parse a duration, additionally accepting days as a unit ("1d", "30d")
+func ParseDuration(s string) (Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.ParseUint(strings.TrimSuffix(s, "d"), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return Duration(time.Duration(n) * 24 * time.Hour), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return Duration(d), nil
+}
+
+// format the duration using the largest whole unit (days, hours, minutes)
+func (d Duration) String() string {
+	switch {
+	case d == 0:
+		return "0s"
+	case time.Duration(d)%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", time.Duration(d)/(24*time.Hour))
+	case time.Duration(d)%time.Hour == 0:
+		return fmt.Sprintf("%dh", time.Duration(d)/time.Hour)
+	case time.Duration(d)%time.Minute == 0:
+		return fmt.Sprintf("%dm", time.Duration(d)/time.Minute)
+	}
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -5,9 +5,26 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+// send a request to esi, recording the status code and the remaining error limit
+func (f *Fetcher) do(req *http.Request) (*http.Response, error) {
+	resp, err := f.client.Do(req)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		f.requestErrors++
+		return nil, err
+	}
+	f.responses[resp.StatusCode]++
+	if remain, err := strconv.Atoi(resp.Header.Get("X-Esi-Error-Limit-Remain")); err == nil {
+		f.errorLimitRemain = remain
+	}
+	return resp, nil
+}
+
 // make a head request to get the expiry for this location
 // as we do not care about the data at this time
 func (f *Fetcher) GetExpiry(fetchReq *fetchRequest, page uint) (time.Time, error) {
@@ -22,10 +39,10 @@ func (f *Fetcher) GetExpiry(fetchReq *fetchRequest, page uint) (time.Time, error
 	}
 
 	if fetchReq.IsCitadel {
-		headReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", f.accessToken))
+		headReq.Header.Set("Authorization", f.authorization())
 	}
 
-	resp, err := f.client.Do(headReq)
+	resp, err := f.do(headReq)
 	if err != nil {
 		return time.Time{}, err
 	} else if resp.StatusCode != http.StatusOK {
@@ -59,16 +76,19 @@ func (f *Fetcher) GetOrders(fetchReq *fetchRequest, cb func(*fetchResponse, uint
 		}
 
 		if fetchReq.IsCitadel {
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", f.accessToken))
+			req.Header.Set("Authorization", f.authorization())
 		}
 
-		resp, err := f.client.Do(req)
+		resp, err := f.do(req)
 		if err != nil {
 			return err
 		} else if resp.StatusCode != http.StatusOK {
 			// retry the request if it failed
 			if retries < 3 {
 				retries++
+				f.mu.Lock()
+				fetchReq.metrics.Retries++
+				f.mu.Unlock()
 				log.Printf("request for page %d returned status code %s; retrying...", page, resp.Status)
 				continue
 			} else {
@@ -110,10 +130,10 @@ func (f *Fetcher) GetLocationName(location uint64, isCitadel bool) (string, erro
 	}
 
 	if isCitadel {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", f.accessToken))
+		req.Header.Set("Authorization", f.authorization())
 	}
 
-	resp, err := f.client.Do(req)
+	resp, err := f.do(req)
 	if err != nil {
 		return "", err
 	} else if resp.StatusCode != http.StatusOK {
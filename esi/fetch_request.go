@@ -1,21 +1,39 @@
 package esi
 
-import "time"
+import (
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
 
 type fetchRequest struct {
 	// region or citadelid
 	LocationID uint64
 	// are we fetching citadel or region orders?
 	IsCitadel bool
+	// the options of the location, overriding the global ones
+	Config orderbookfetcher.LocationConfig
 	// when does the endpoint expire?
 	Expiry time.Time
 	// how often have we skipped fetching the endpoint?
 	Skipped int
-	// which orderbooks are currently on disk
+	// how often have we skipped it in total?
+	SkippedTotal uint
+	// which orderbooks are currently on disk, oldest first
 	FilesWritten []string
+	// expiry of the last orderbook we've written
+	LastWritten time.Time
+	// the last thing that went wrong
+	LastError     string
+	LastErrorTime time.Time
+
+	// counters exposed as metrics
+	metrics orderbookfetcher.LocationMetrics
+	// fetch it the next time, even if it would be skipped
+	force bool
+	// has the location been removed while it was being worked on?
+	removed bool
 
 	// required by the heap interface
 	index int
-	// used to delete old orderbooks
-	totalWritten uint
 }
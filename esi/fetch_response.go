@@ -1,8 +1,12 @@
 package esi
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
@@ -19,44 +23,95 @@ type fetchResponse struct {
 	IsCitadel bool
 }
 
-// create a new orderbook csv file and write the current order page to it
-func (r *fetchResponse) CreateNewCSV() (*os.File, *orderbookfetcher.OrderbookInfo, error) {
-	// create the csv file, made up of location and expiry timestamp
-	fileName := fmt.Sprintf("orderbooks/%d_%d.csv", r.LocationID, r.Expiry.Unix())
-	file, err := os.Create(fileName + ".tmp")
+// an orderbook that's being written to a tmp file, gzipped if the format asks for it
+type orderbookFile struct {
+	file *os.File
+	gz   *gzip.Writer
+	// where the orders are written to
+	w io.Writer
+	// the name of the file once it's complete
+	name string
+}
+
+// create the tmp file of an orderbook in the directory
+func createOrderbookFile(directory string, location uint64, expiry time.Time, format string) (*orderbookFile, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+	// made up of location and expiry timestamp
+	name := filepath.Join(directory, fmt.Sprintf("%d_%d.csv", location, expiry.Unix()))
+	if format == orderbookfetcher.FormatCSVGzip {
+		name += ".gz"
+	}
+	file, err := os.Create(name + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	o := &orderbookFile{file: file, w: file, name: name}
+	if strings.HasSuffix(name, ".gz") {
+		o.gz = gzip.NewWriter(file)
+		o.w = o.gz
+	}
+	return o, nil
+}
+
+// flush and close the tmp file
+func (o *orderbookFile) Close() error {
+	if o.gz != nil {
+		if err := o.gz.Close(); err != nil {
+			o.file.Close()
+			return err
+		}
+	}
+	return o.file.Close()
+}
+
+// give the closed tmp file its final name
+func (o *orderbookFile) Commit() error {
+	return os.Rename(o.file.Name(), o.name)
+}
+
+// throw away what has been written so far
+func (o *orderbookFile) Abort() {
+	o.Close()
+	os.Remove(o.file.Name())
+}
+
+// create a new orderbook file and write the current order page to it.
+// only the orders of types are written, all of them if it's empty
+func (r *fetchResponse) CreateNewCSV(directory, format string, types map[int32]struct{}) (*orderbookFile, *orderbookfetcher.OrderbookInfo, error) {
+	file, err := createOrderbookFile(directory, r.LocationID, r.Expiry, format)
 	if err != nil {
 		return nil, nil, err
 	}
 	// create some stats about the orders we are writing
 	info := orderbookfetcher.NewOrderbookInfo(r.LocationID, r.Expiry, r.IsCitadel)
 	// write the column names
-	_, err = fmt.Fprintln(file, "ORDERID,TYPEID,SYSTEMID,LOCATIONID,PRICE,RANGE,ISBUY,ISSUED,DURATION,MINVOLUME,VOLUMEREMAIN,VOLUMETOTAL")
+	_, err = fmt.Fprintln(file.w, orderbookfetcher.CSVHeader)
 	if err != nil {
+		file.Abort()
 		return nil, nil, err
 	}
 
 	// write all of the orders
-	for _, order := range r.Orders {
-		info.OrderCount++
-		if order.IsBuyOrder {
-			info.BuyOrderCount++
-		} else {
-			info.SellOrderCount++
-		}
-		order.WriteAsCSV(file)
-	}
+	r.WriteToExistingCSV(file, info, types)
 	return file, info, nil
 }
 
 // write a page of orders to an already exisitng orderbook file
-func (r *fetchResponse) WriteToExistingCSV(file *os.File, info *orderbookfetcher.OrderbookInfo) {
+func (r *fetchResponse) WriteToExistingCSV(file *orderbookFile, info *orderbookfetcher.OrderbookInfo, types map[int32]struct{}) {
 	for _, order := range r.Orders {
+		if len(types) > 0 {
+			if _, ok := types[order.TypeID]; !ok {
+				continue
+			}
+		}
 		info.OrderCount++
 		if order.IsBuyOrder {
 			info.BuyOrderCount++
 		} else {
 			info.SellOrderCount++
 		}
-		order.WriteAsCSV(file)
+		order.WriteAsCSV(file.w)
 	}
 }
@@ -3,24 +3,34 @@ package esi
 import (
 	"container/heap"
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"strings"
 	"sync"
 	"time"
 
 	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
 )
 
+// how long to wait before trying a failed fetch again
+const retryDelay = time.Minute
+
 type Fetcher struct {
 	// http client used to make the esi requests
 	client *http.Client
 
 	// cancellation function to stop program execution
 	cancel context.CancelFunc
+	// cancelled on shutdown, used to start the token refresher later on
+	ctx context.Context
+	// wakes the worker up when the queue has changed
+	wake chan struct{}
 	// wait for goroutines to finish
 	wg sync.WaitGroup
+	// guards the state that is read by the http server
+	// (Locations, WrittenOrderbooks and the requests)
+	mu sync.RWMutex
 
 	// base URLs for fetching region or citadel orders
 	citadelURL string
@@ -28,25 +38,70 @@ type Fetcher struct {
 
 	// holds our requests
 	pq PriorityQueue
+	// look up a request by location, includes the one that's currently being worked on
+	requests map[uint64]*fetchRequest
 
 	// configuration
 	config *orderbookfetcher.Configuration
 
+	// guards the tokens, they are read by the worker and the http handlers adding locations
+	// while the token refresher replaces them
+	tokensMu sync.RWMutex
 	// ESI access token used to make authenticated requests
 	accessToken string
 	tokenExpiry time.Time
+	// the latest refresh token, starts out as the one from the configuration or the token store
+	refreshToken string
+	// verify the access tokens
+	keys *keySet
+	// whose access token we are using
+	character *orderbookfetcher.Character
+	// guards starting the token refresher
+	tokenMu sync.Mutex
+	// is the token refresher running?
+	refreshing bool
+
+	// when has the fetcher been started?
+	started time.Time
+
+	// esi responses by status code
+	responses     map[int]uint
+	requestErrors uint
+	// the last value of X-Esi-Error-Limit-Remain, -1 if we haven't seen one yet
+	errorLimitRemain int
+	// token refresh outcomes
+	tokenRefreshes       uint
+	tokenRefreshFailures uint
+
+	// why the worker or the token refresher stopped, empty while they are running
+	workerExit    string
+	refresherExit string
 
 	// look up the name of a structure or region by id
 	Locations map[uint64]string
 	// look up information about the orderbook by filename
 	WrittenOrderbooks map[string]*orderbookfetcher.OrderbookInfo
+
+	// get passed every orderbook that has been written to disk
+	handlers []orderbookfetcher.SnapshotHandler
+	// get notified about everything that happens
+	eventHandlers []orderbookfetcher.EventHandler
+
+	// keeps the tokens between runs, optional
+	TokenStore orderbookfetcher.TokenStore
 }
 
 func NewFetcher(config *orderbookfetcher.Configuration) *Fetcher {
 	return &Fetcher{
 		config:            config,
+		refreshToken:      config.RefreshToken,
+		keys:              newKeySet(config.JWKSURL),
 		Locations:         make(map[uint64]string, len(config.Regions)+len(config.Citadels)),
 		WrittenOrderbooks: make(map[string]*orderbookfetcher.OrderbookInfo),
+		requests:          make(map[uint64]*fetchRequest),
+		responses:         make(map[int]uint),
+		errorLimitRemain:  -1,
+		wake:              make(chan struct{}, 1),
 		client:            http.DefaultClient,
 
 		citadelURL: "https://esi.evetech.net/latest/markets/structures/%d/?datasource=tranquility&page=%d",
@@ -58,6 +113,8 @@ func (f *Fetcher) Start() (err error) {
 	// context required for cancellation
 	var ctx context.Context
 	ctx, f.cancel = context.WithCancel(context.Background())
+	f.ctx = ctx
+	f.started = time.Now().UTC()
 
 	// queue holds as many elements as we have locations
 	queueLength := len(f.config.Regions) + len(f.config.Citadels)
@@ -66,13 +123,10 @@ func (f *Fetcher) Start() (err error) {
 	// get our initial access token
 	// before we start the goroutine
 	if len(f.config.Citadels) > 0 {
-		tokens, err := f.RefreshToken()
-		if err != nil {
+		if err := f.initTokens(); err != nil {
 			log.Printf("failed to refresh tokens: %s", err)
 			return err
 		}
-		f.accessToken = tokens.AccessToken
-		f.tokenExpiry = time.Now().Add(time.Second * time.Duration(tokens.ExpiresIn-5))
 	}
 
 	// create requests for the locations to be fetched
@@ -84,26 +138,25 @@ func (f *Fetcher) Start() (err error) {
 
 		// fetch the location name for every location
 		// and add them to the map
-		_, ok := f.Locations[location]
+		_, ok := f.Locations[location.ID]
 		if !ok {
-			locName, err := f.GetLocationName(location, isCitadel)
+			locName, err := f.configuredName(location, isCitadel)
 			if err != nil {
 				return err
 			}
-			log.Printf("%d - %s", location, locName)
-			f.Locations[location] = locName
+			log.Printf("%d - %s", location.ID, locName)
+			f.Locations[location.ID] = locName
 		}
 
 		// construct the request
 		// and put it in the queue
-		f.pq[i] = &fetchRequest{
-			LocationID:   location,
-			IsCitadel:    isCitadel,
-			Expiry:       time.Now(),
-			Skipped:      -1,
-			FilesWritten: make([]string, f.config.RetentionPeriod),
-			totalWritten: 0,
-		}
+		f.pq[i] = newFetchRequest(location, isCitadel)
+		f.pq[i].index = i
+		f.requests[location.ID] = f.pq[i]
+
+		// pick up the orderbooks of the previous runs
+		fileNames, infos := storedOrderbooks(f.directory(f.pq[i]), location.ID, isCitadel, f.Locations[location.ID])
+		f.seedOrderbooks(f.pq[i], fileNames, infos)
 	}
 
 	// sort the priority queue
@@ -112,23 +165,101 @@ func (f *Fetcher) Start() (err error) {
 	// work on the requests
 	f.wg.Add(1)
 	go func() {
-		f.worker(ctx)
-		f.wg.Done()
+		defer f.wg.Done()
+		if err := f.worker(ctx); err != nil {
+			log.Printf("worker stopped: %s", err)
+			f.mu.Lock()
+			f.workerExit = err.Error()
+			f.mu.Unlock()
+		}
+	}()
+
+	// apply the retention policies to what's on disk
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.janitor(ctx)
 	}()
 
 	// only keep the token refreshed
 	// if we have to request citadel orders
 	if len(f.config.Citadels) > 0 {
-		f.wg.Add(1)
-		go func() {
-			f.tokenRefresher(ctx)
-			f.wg.Done()
-		}()
+		f.tokenMu.Lock()
+		f.startTokenRefresher()
+		f.tokenMu.Unlock()
 	}
 
 	return nil
 }
 
+// a request that gets fetched right away
+func newFetchRequest(location orderbookfetcher.LocationConfig, isCitadel bool) *fetchRequest {
+	return &fetchRequest{
+		LocationID: location.ID,
+		IsCitadel:  isCitadel,
+		Config:     location,
+		Expiry:     time.Now(),
+		Skipped:    -1,
+	}
+}
+
+// the name from the configuration, looked up on esi if there is none
+func (f *Fetcher) configuredName(location orderbookfetcher.LocationConfig, isCitadel bool) (string, error) {
+	if location.Name != "" {
+		return location.Name, nil
+	}
+	return f.GetLocationName(location.ID, isCitadel)
+}
+
+// fetch the request every n orderbooks. f.mu has to be held
+func (f *Fetcher) interval(request *fetchRequest) uint {
+	if request.Config.Interval > 0 {
+		return request.Config.Interval
+	}
+	return f.config.Interval
+}
+
+// how many orderbooks of the request to keep, all of them if zero. f.mu has to be held
+func (f *Fetcher) retentionPeriod(request *fetchRequest) uint {
+	if request.Config.RetentionPeriod != nil {
+		return *request.Config.RetentionPeriod
+	}
+	return f.config.RetentionPeriod
+}
+
+// where the orderbooks of the request are written to. f.mu has to be held
+func (f *Fetcher) directory(request *fetchRequest) string {
+	if request.Config.Directory != "" {
+		return request.Config.Directory
+	}
+	return f.config.OrderbookDirectory
+}
+
+// keep the access token refreshed in the background, f.tokenMu has to be held
+func (f *Fetcher) startTokenRefresher() {
+	f.refreshing = true
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if err := f.tokenRefresher(f.ctx); err != nil {
+			log.Printf("token refresher stopped: %s", err)
+			f.mu.Lock()
+			f.refresherExit = err.Error()
+			f.mu.Unlock()
+		}
+	}()
+}
+
+// register a handler for new orderbooks, has to be called before Start
+func (f *Fetcher) AddSnapshotHandler(handler orderbookfetcher.SnapshotHandler) {
+	f.handlers = append(f.handlers, handler)
+}
+
+// register a handler for events, has to be called before Start
+func (f *Fetcher) AddEventHandler(handler orderbookfetcher.EventHandler) {
+	f.eventHandlers = append(f.eventHandlers, handler)
+}
+
 func (f *Fetcher) Shutdown() {
 	log.Println("shutting down...")
 	// cancel the context and wait for execution to finish
@@ -138,115 +269,302 @@ func (f *Fetcher) Shutdown() {
 	log.Println("done!")
 }
 
-func (f *Fetcher) worker(ctx context.Context) {
-	for len(f.pq) > 0 {
-		// get our request with the earliest expiry from the heap
-		request := heap.Pop(&f.pq).(*fetchRequest)
-		// wait until it expires
-		wait := time.Until(request.Expiry) + time.Second*1
-		log.Printf("location %d expires in %s", request.LocationID, wait)
+// works on the requests until the context is cancelled,
+// returns an error if it can't go on
+func (f *Fetcher) worker(ctx context.Context) error {
+	for {
+		// peek at the request with the earliest expiry,
+		// it stays in the queue while we wait so it can still be removed or rescheduled
+		f.mu.RLock()
+		var next *fetchRequest
+		var wait time.Duration
+		if len(f.pq) > 0 {
+			next = f.pq[0]
+			wait = time.Until(next.Expiry) + time.Second*1
+		}
+		f.mu.RUnlock()
+
+		// wait until it expires, without a request we only wait for the queue to change
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if next != nil {
+			log.Printf("location %d expires in %s", next.LocationID, wait)
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
 		select {
-		case <-time.After(wait):
-			// are we skipping or fetching?
-			if request.Skipped != -1 && f.config.Interval > uint(request.Skipped+1) {
-				var err error
-				request.Expiry, err = f.GetExpiry(request, 1)
-				if err != nil {
-					log.Printf("failed to fetch the expiry: %s", err)
-					return
-				}
-				request.Skipped++
-				heap.Push(&f.pq, request)
-				continue
-
-			} else {
-				log.Printf("fetching location %d", request.LocationID)
-				// csv file containing the orderbook
-				var file *os.File
-				// some stats about the orderbook
-				var info *orderbookfetcher.OrderbookInfo
-				if err := f.GetOrders(request, func(fr *fetchResponse, page uint) {
-					// are we making a new orderbook or writing to an existing one?
-					if page == 1 {
-						var err error
-						file, info, err = fr.CreateNewCSV()
-						if err != nil {
-							log.Printf("failed to create file: %s", err)
-						}
-						request.Expiry = fr.Expiry
-						info.LocationName = f.Locations[request.LocationID]
-					} else {
-						fr.WriteToExistingCSV(file, info)
-					}
-
-				}); err != nil {
-					log.Printf("failed to fetch orders: %s", err)
-				}
-
-				// close the file
-				if err := file.Close(); err != nil {
-					log.Printf("failed to close: %s", err)
-					return
-				}
-
-				// remove the tmp file as we are done writing
-				fileName := strings.Trim(file.Name(), ".tmp")
-				if err := os.Rename(file.Name(), fileName); err != nil {
-					log.Printf("failed to rename: %s", err)
-					return
-				}
-
-				// do we have to delete an old orderbook?
-				if request.totalWritten < f.config.RetentionPeriod {
-					// add the file to the slice
-					request.FilesWritten[request.totalWritten] = fileName
-					request.totalWritten++
-				} else if f.config.RetentionPeriod > 0 {
-					// index of the file to be removed
-					idx := request.totalWritten % f.config.RetentionPeriod
-					// remove the file from disk
-					os.Remove(request.FilesWritten[idx])
-					log.Printf("removed file: %s", request.FilesWritten[idx])
-					// remove it from the map
-					delete(f.WrittenOrderbooks, request.FilesWritten[idx])
-					// overwrite it with the new file
-					request.FilesWritten[idx] = fileName
-					request.totalWritten++
-				}
-				// put the info into the map
-				f.WrittenOrderbooks[fileName] = info
-				log.Printf("finished fetching location %d", request.LocationID)
-				request.Skipped = 0
-
-				// add the request back to the heap
-				heap.Push(&f.pq, request)
+		case <-expired:
+		case <-f.wake:
+			// the queue has changed, have another look
+			stopTimer(timer)
+			continue
+		case <-ctx.Done():
+			stopTimer(timer)
+			return nil
+		}
+
+		// make sure nothing has changed while we were waiting
+		f.mu.Lock()
+		if len(f.pq) == 0 || f.pq[0] != next || time.Now().Before(next.Expiry) {
+			f.mu.Unlock()
+			continue
+		}
+		request := heap.Pop(&f.pq).(*fetchRequest)
+		force := request.force
+		request.force = false
+		interval := f.interval(request)
+		f.mu.Unlock()
+
+		// are we skipping or fetching?
+		if !force && request.Skipped != -1 && interval > uint(request.Skipped+1) {
+			f.skip(request)
+		} else if err := f.fetch(request); err != nil {
+			return err
+		}
+	}
+}
+
+// move the request on to the next expiry without fetching it,
+// it's tried again after the retry delay if the expiry can't be fetched
+func (f *Fetcher) skip(request *fetchRequest) {
+	expiry, err := f.GetExpiry(request, 1)
+	if err != nil {
+		log.Printf("failed to fetch the expiry: %s", err)
+		f.emitFailure(orderbookfetcher.EventFetchFailed, request, err)
+		// try again later, the other locations go on
+		f.mu.Lock()
+		request.Expiry = time.Now().Add(retryDelay)
+		f.requeue(request)
+		f.mu.Unlock()
+		return
+	}
+	f.mu.Lock()
+	request.Expiry = expiry
+	request.Skipped++
+	request.SkippedTotal++
+	request.metrics.Skipped++
+	f.requeue(request)
+	f.mu.Unlock()
+	f.emit(&orderbookfetcher.Event{
+		Type:         orderbookfetcher.EventLocationSkipped,
+		LocationID:   request.LocationID,
+		LocationName: f.locationName(request.LocationID),
+	})
+}
+
+// fetch the orderbook of the request and write it to disk
+func (f *Fetcher) fetch(request *fetchRequest) error {
+	log.Printf("fetching location %d", request.LocationID)
+	// the options can change through a reload while we are fetching
+	f.mu.RLock()
+	directory, format := f.directory(request), request.Config.Format
+	var types map[int32]struct{}
+	if len(request.Config.Types) > 0 {
+		types = make(map[int32]struct{}, len(request.Config.Types))
+		for _, typeID := range request.Config.Types {
+			types[typeID] = struct{}{}
+		}
+	}
+	f.mu.RUnlock()
+
+	// csv file containing the orderbook
+	var file *orderbookFile
+	// some stats about the orderbook
+	var info *orderbookfetcher.OrderbookInfo
+	// how many pages did the orderbook have?
+	var pages uint
+	var createErr error
+	started := time.Now()
+	if err := f.GetOrders(request, func(fr *fetchResponse, page uint) {
+		pages = page
+		// are we making a new orderbook or writing to an existing one?
+		if page == 1 {
+			var err error
+			file, info, err = fr.CreateNewCSV(directory, format, types)
+			if err != nil {
+				log.Printf("failed to create file: %s", err)
+				// nothing to write the remaining pages to
+				createErr = err
+				return
 			}
+			f.mu.Lock()
+			request.Expiry = fr.Expiry
+			f.mu.Unlock()
+			info.LocationName = f.locationName(request.LocationID)
+		} else if file != nil {
+			fr.WriteToExistingCSV(file, info, types)
+		}
 
-		case <-ctx.Done():
-			return
+	}); err != nil || createErr != nil {
+		if err == nil {
+			err = createErr
 		}
+		log.Printf("failed to fetch orders: %s", err)
+		f.emitFailure(orderbookfetcher.EventFetchFailed, request, err)
+		// throw away what we've got so far and try again later
+		if file != nil {
+			file.Abort()
+		}
+		f.mu.Lock()
+		request.metrics.Pages += pages
+		request.Expiry = time.Now().Add(retryDelay)
+		f.requeue(request)
+		f.mu.Unlock()
+		return nil
+	}
+	f.mu.Lock()
+	request.metrics.Pages += pages
+	f.mu.Unlock()
+
+	// close the file
+	if err := file.Close(); err != nil {
+		log.Printf("failed to close: %s", err)
+		return fmt.Errorf("failed to close %s: %w", file.name, err)
+	}
+
+	// remove the tmp file as we are done writing
+	fileName := file.name
+	if err := file.Commit(); err != nil {
+		log.Printf("failed to rename: %s", err)
+		return fmt.Errorf("failed to rename %s: %w", fileName, err)
+	}
+
+	f.mu.Lock()
+	// a forced fetch before the expiry overwrites the last orderbook,
+	// it already has its place in the retention
+	if _, overwritten := f.WrittenOrderbooks[fileName]; !overwritten {
+		request.FilesWritten = append(request.FilesWritten, fileName)
+	}
+	// put the info into the map
+	f.WrittenOrderbooks[fileName] = info
+	// do we have to delete old orderbooks?
+	f.enforceRetention(request)
+	request.Skipped = 0
+	request.LastWritten = info.Date
+	request.metrics.Fetches++
+	request.metrics.LastPages = pages
+	request.metrics.LastFetchDuration = time.Since(started)
+	request.metrics.FetchDuration += request.metrics.LastFetchDuration
+	request.metrics.LastOrderbook = info
+	f.mu.Unlock()
+	log.Printf("finished fetching location %d", request.LocationID)
+	f.emit(&orderbookfetcher.Event{
+		Type:         orderbookfetcher.EventSnapshotCommitted,
+		LocationID:   request.LocationID,
+		LocationName: info.LocationName,
+		Orderbook:    info,
+		FileName:     fileName,
+	})
+	f.handleSnapshot(fileName, info)
+
+	// add the request back to the heap
+	f.mu.Lock()
+	f.requeue(request)
+	f.mu.Unlock()
+	return nil
+}
+
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+// delete the oldest orderbooks of the request until it's within the retention period.
+// f.mu has to be held
+func (f *Fetcher) enforceRetention(request *fetchRequest) {
+	retention := f.retentionPeriod(request)
+	if retention == 0 {
+		return
+	}
+	for uint(len(request.FilesWritten)) > retention {
+		oldest := request.FilesWritten[0]
+		// remove the file from disk
+		os.Remove(oldest)
+		log.Printf("removed file: %s", oldest)
+		// remove it from the map
+		delete(f.WrittenOrderbooks, oldest)
+		request.FilesWritten = request.FilesWritten[1:]
+	}
+}
+
+// put a request back into the queue, unless its location has been removed in the meantime.
+// f.mu has to be held
+func (f *Fetcher) requeue(request *fetchRequest) {
+	if request.removed {
+		return
 	}
+	heap.Push(&f.pq, request)
 }
 
-// refreshes the access token every 20 minutes
-func (f *Fetcher) tokenRefresher(ctx context.Context) {
+// refreshes the access token every 20 minutes,
+// returns an error if that fails
+func (f *Fetcher) tokenRefresher(ctx context.Context) error {
 	for {
 		select {
 		// wait for the token to expiry
-		case <-time.After(time.Until(f.tokenExpiry)):
-			tokens, err := f.RefreshToken()
-			if err != nil {
+		case <-time.After(time.Until(f.currentToken().Expiry)):
+			if err := f.renewTokens(); err != nil {
 				log.Printf("failed to fetch tokens: %s", err)
-				return
+				f.emitFailure(orderbookfetcher.EventTokenRefreshFailed, nil, err)
+				return fmt.Errorf("failed to refresh the access token: %w", err)
+			}
+			// the token has been fine so far, it's most likely the keys that can't be fetched
+			if err := f.checkAccessToken(); err != nil {
+				log.Printf("failed to verify the refreshed access token: %s", err)
 			}
-			// set the new token + expiry
-			f.accessToken = tokens.AccessToken
-			f.tokenExpiry = time.Now().Add(time.Second * time.Duration(tokens.ExpiresIn-5))
 
 			log.Println("refreshed token")
 
 		case <-ctx.Done():
-			return
+			return nil
+		}
+	}
+}
+
+// read a freshly written orderbook back in and pass it on to the handlers
+func (f *Fetcher) handleSnapshot(fileName string, info *orderbookfetcher.OrderbookInfo) {
+	if len(f.handlers) == 0 {
+		return
+	}
+	snapshot, err := orderbookfetcher.LoadSnapshot(fileName, info)
+	if err != nil {
+		log.Printf("failed to load snapshot: %s", err)
+		return
+	}
+	for _, handler := range f.handlers {
+		if err := handler.HandleSnapshot(snapshot); err != nil {
+			log.Printf("failed to handle snapshot %s: %s", fileName, err)
+		}
+	}
+}
+
+// pass an event on to the handlers
+func (f *Fetcher) emit(event *orderbookfetcher.Event) {
+	event.Time = time.Now().UTC()
+	for _, handler := range f.eventHandlers {
+		handler.HandleEvent(event)
+	}
+}
+
+// pass a failure on to the handlers, request is nil if it isn't about a location
+func (f *Fetcher) emitFailure(eventType orderbookfetcher.EventType, request *fetchRequest, err error) {
+	event := &orderbookfetcher.Event{
+		Type:  eventType,
+		Error: err.Error(),
+	}
+	if request != nil {
+		f.mu.Lock()
+		request.metrics.Failures++
+		request.LastError = err.Error()
+		request.LastErrorTime = time.Now().UTC()
+		f.mu.Unlock()
+		event.LocationID = request.LocationID
+		event.LocationName = f.locationName(request.LocationID)
+		if !request.LastWritten.IsZero() {
+			lastWritten := request.LastWritten
+			event.LastSnapshot = &lastWritten
 		}
 	}
+	f.emit(event)
 }
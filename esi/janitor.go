@@ -0,0 +1,273 @@
+package esi
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+const (
+	// after this long only one orderbook per hour is kept when downsampling
+	hourlyAfter = 24 * time.Hour
+	// after this long only one orderbook per day is kept
+	dailyAfter = 30 * 24 * time.Hour
+)
+
+// an orderbook file found on disk
+type storedOrderbook struct {
+	fileName string
+	location uint64
+	expiry   time.Time
+	size     int64
+}
+
+// the policies that apply to the orderbooks of a location
+type retentionPolicy struct {
+	// keep the last n orderbooks, all of them if zero
+	count    uint
+	maxAge   time.Duration
+	maxBytes int64
+}
+
+// applies the retention policies until the context is cancelled
+func (f *Fetcher) janitor(ctx context.Context) {
+	for {
+		f.cleanUp()
+		f.mu.RLock()
+		interval := time.Duration(f.config.Retention.Interval)
+		f.mu.RUnlock()
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// apply the retention policies to every orderbook on disk, including the ones of previous runs.
+// the newest orderbook of every location is always kept
+func (f *Fetcher) cleanUp() {
+	f.mu.RLock()
+	retention := f.config.Retention
+	// locations that aren't fetched anymore get the global policies
+	defaultPolicy := retentionPolicy{
+		count:    f.config.RetentionPeriod,
+		maxAge:   time.Duration(retention.MaxAge),
+		maxBytes: int64(retention.LocationMaxBytes),
+	}
+	policies := make(map[uint64]retentionPolicy, len(f.requests))
+	directories := map[string]struct{}{filepath.Clean(f.config.OrderbookDirectory): {}}
+	for location, request := range f.requests {
+		policies[location] = f.retentionPolicy(request)
+		directories[filepath.Clean(f.directory(request))] = struct{}{}
+	}
+	f.mu.RUnlock()
+
+	byLocation := make(map[uint64][]storedOrderbook)
+	for directory := range directories {
+		for _, orderbook := range scanOrderbooks(directory) {
+			byLocation[orderbook.location] = append(byLocation[orderbook.location], orderbook)
+		}
+	}
+
+	now := time.Now()
+	// why an orderbook gets deleted by file name
+	doomed := make(map[string]string)
+	// what's left after the location policies, without the newest orderbooks
+	var kept []storedOrderbook
+	var total int64
+	for location, orderbooks := range byLocation {
+		policy, ok := policies[location]
+		if !ok {
+			policy = defaultPolicy
+		}
+		// newest first
+		sort.Slice(orderbooks, func(i, j int) bool { return orderbooks[i].expiry.After(orderbooks[j].expiry) })
+		count := uint(1)
+		size := orderbooks[0].size
+		// once an orderbook doesn't fit, neither do the older ones
+		overBudget := false
+		var lastHour, lastDay time.Time
+		for _, orderbook := range orderbooks[1:] {
+			age := now.Sub(orderbook.expiry)
+			hour, day := orderbook.expiry.Truncate(time.Hour), orderbook.expiry.Truncate(24*time.Hour)
+			switch {
+			case policy.count > 0 && count >= policy.count:
+				doomed[orderbook.fileName] = "retention period"
+			case policy.maxAge > 0 && age > policy.maxAge:
+				doomed[orderbook.fileName] = "max age"
+			case retention.Downsample && age > dailyAfter && day.Equal(lastDay):
+				doomed[orderbook.fileName] = "downsampled to one per day"
+			case retention.Downsample && age > hourlyAfter && age <= dailyAfter && hour.Equal(lastHour):
+				doomed[orderbook.fileName] = "downsampled to one per hour"
+			case policy.maxBytes > 0 && (overBudget || size+orderbook.size > policy.maxBytes):
+				overBudget = true
+				doomed[orderbook.fileName] = "location disk budget"
+			default:
+				count++
+				size += orderbook.size
+				lastHour, lastDay = hour, day
+				kept = append(kept, orderbook)
+			}
+		}
+		total += size
+	}
+
+	// the global budget evicts the oldest orderbooks across all locations
+	if maxBytes := int64(retention.MaxBytes); maxBytes > 0 && total > maxBytes {
+		sort.Slice(kept, func(i, j int) bool { return kept[i].expiry.Before(kept[j].expiry) })
+		for _, orderbook := range kept {
+			if total <= maxBytes {
+				break
+			}
+			doomed[orderbook.fileName] = "disk budget"
+			total -= orderbook.size
+		}
+	}
+	if len(doomed) > 0 {
+		f.removeOrderbooks(doomed)
+	}
+}
+
+// the policies of a request, f.mu has to be held
+func (f *Fetcher) retentionPolicy(request *fetchRequest) retentionPolicy {
+	policy := retentionPolicy{
+		count:    f.retentionPeriod(request),
+		maxAge:   time.Duration(f.config.Retention.MaxAge),
+		maxBytes: int64(f.config.Retention.LocationMaxBytes),
+	}
+	if request.Config.MaxAge > 0 {
+		policy.maxAge = time.Duration(request.Config.MaxAge)
+	}
+	if request.Config.MaxBytes > 0 {
+		policy.maxBytes = int64(request.Config.MaxBytes)
+	}
+	return policy
+}
+
+// delete the orderbooks from disk and forget about them
+func (f *Fetcher) removeOrderbooks(doomed map[string]string) {
+	for fileName, reason := range doomed {
+		if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to remove %s: %s", fileName, err)
+			delete(doomed, fileName)
+			continue
+		}
+		log.Printf("removed file: %s (%s)", fileName, reason)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for fileName := range doomed {
+		delete(f.WrittenOrderbooks, fileName)
+	}
+	for _, request := range f.requests {
+		files := request.FilesWritten[:0]
+		for _, fileName := range request.FilesWritten {
+			if _, ok := doomed[fileName]; !ok {
+				files = append(files, fileName)
+			}
+		}
+		request.FilesWritten = files
+	}
+}
+
+// the orderbooks of a location that are already in the directory, oldest first.
+// only the newest one is read to count its orders, reading all of them would hold up the start
+func storedOrderbooks(directory string, location uint64, isCitadel bool, name string) ([]string, map[string]*orderbookfetcher.OrderbookInfo) {
+	var orderbooks []storedOrderbook
+	for _, orderbook := range scanOrderbooks(directory) {
+		if orderbook.location == location {
+			orderbooks = append(orderbooks, orderbook)
+		}
+	}
+	sort.Slice(orderbooks, func(i, j int) bool { return orderbooks[i].expiry.Before(orderbooks[j].expiry) })
+
+	fileNames := make([]string, 0, len(orderbooks))
+	infos := make(map[string]*orderbookfetcher.OrderbookInfo, len(orderbooks))
+	for i, orderbook := range orderbooks {
+		info := orderbookfetcher.NewOrderbookInfo(location, orderbook.expiry, isCitadel)
+		info.LocationName = name
+		if i == len(orderbooks)-1 {
+			if err := countOrders(orderbook.fileName, info); err != nil {
+				log.Printf("failed to count the orders of %s: %s", orderbook.fileName, err)
+			}
+		}
+		fileNames = append(fileNames, orderbook.fileName)
+		infos[orderbook.fileName] = info
+	}
+	return fileNames, infos
+}
+
+// add the stored orderbooks to the ones written by the request, f.mu has to be held
+func (f *Fetcher) seedOrderbooks(request *fetchRequest, fileNames []string, infos map[string]*orderbookfetcher.OrderbookInfo) {
+	for _, fileName := range fileNames {
+		request.FilesWritten = append(request.FilesWritten, fileName)
+		f.WrittenOrderbooks[fileName] = infos[fileName]
+	}
+	if len(fileNames) > 0 {
+		request.LastWritten = infos[fileNames[len(fileNames)-1]].Date
+		log.Printf("found %d orderbooks of location %d", len(fileNames), request.LocationID)
+	}
+}
+
+// count the orders of an orderbook file into its info
+func countOrders(fileName string, info *orderbookfetcher.OrderbookInfo) error {
+	file, err := orderbookfetcher.OpenOrderbook(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := orderbookfetcher.NewOrderReader(file)
+	var buy, sell uint
+	for {
+		order, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if order.IsBuyOrder {
+			buy++
+		} else {
+			sell++
+		}
+	}
+	info.OrderCount, info.BuyOrderCount, info.SellOrderCount = buy+sell, buy, sell
+	return nil
+}
+
+// every orderbook file in the directory, files that are still being written are left out
+func scanOrderbooks(directory string) []storedOrderbook {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("failed to read %s: %s", directory, err)
+		}
+		return nil
+	}
+	orderbooks := make([]storedOrderbook, 0, len(entries))
+	for _, entry := range entries {
+		location, expiry, err := orderbookfetcher.ParseOrderbookFileName(entry.Name())
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		orderbooks = append(orderbooks, storedOrderbook{
+			fileName: filepath.Join(directory, entry.Name()),
+			location: location,
+			expiry:   expiry,
+			size:     info.Size(),
+		})
+	}
+	return orderbooks
+}
@@ -0,0 +1,40 @@
+package esi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+func TestCleanUpLocationBudget(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().Truncate(time.Minute)
+	// newest first, the second one doesn't fit anymore but the smaller third one would
+	sizes := []int{100, 80, 10, 10}
+	var fileNames []string
+	for i, size := range sizes {
+		fileName := filepath.Join(dir, fmt.Sprintf("10000002_%d.csv", now.Add(-time.Duration(i)*5*time.Minute).Unix()))
+		if err := os.WriteFile(fileName, []byte(strings.Repeat("x", size)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fileNames = append(fileNames, fileName)
+	}
+
+	f := NewFetcher(&orderbookfetcher.Configuration{
+		OrderbookDirectory: dir,
+		Retention:          orderbookfetcher.RetentionConfig{LocationMaxBytes: 150},
+	})
+	f.cleanUp()
+
+	for i, fileName := range fileNames {
+		_, err := os.Stat(fileName)
+		if kept := err == nil; kept != (i == 0) {
+			t.Errorf("orderbook %d: expected only the newest one to be kept, kept: %t", i, kept)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package esi
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+const (
+	// how long the signing keys of the sso are cached
+	jwksCacheDuration = time.Hour
+	// how long to wait before fetching the keys again because of an unknown key id
+	jwksRetryDelay = time.Minute
+)
+
+var ErrInvalidToken = errors.New("invalid access token")
+
+// fetches and caches the keys the sso signs the access tokens with
+type keySet struct {
+	mu sync.Mutex
+	// where the keys are fetched from
+	url  string
+	keys map[string]*rsa.PublicKey
+	// when the keys have been fetched last
+	fetched time.Time
+}
+
+func newKeySet(url string) *keySet {
+	return &keySet{url: url}
+}
+
+// look up a key by its id, the keys are fetched again once the cache has expired
+// or if the sso has started to use a key we don't know about yet.
+// a key we already know is still used if the keys can't be fetched
+func (s *keySet) key(client *http.Client, id string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if ok && time.Since(s.fetched) < jwksCacheDuration {
+		return key, nil
+	}
+	if ok || time.Since(s.fetched) >= jwksRetryDelay {
+		if err := s.fetch(client); err != nil {
+			if ok {
+				log.Printf("failed to fetch the sso keys, using the cached key %q: %s", id, err)
+				return key, nil
+			}
+			return nil, fmt.Errorf("failed to fetch the sso keys: %w", err)
+		}
+	}
+	if key, ok = s.keys[id]; !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, id)
+	}
+	return key, nil
+}
+
+// load the rsa keys of the set, s.mu has to be held
+func (s *keySet) fetch(client *http.Client) error {
+	response, err := client.Get(s.url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("request returned status: %s", response.Status)
+	}
+	var set struct {
+		Keys []struct {
+			ID       string `json:"kid"`
+			Type     string `json:"kty"`
+			Modulus  string `json:"n"`
+			Exponent string `json:"e"`
+		} `json:"keys"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&set); err != nil {
+		return err
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, key := range set.Keys {
+		// the sso also publishes an ES256 key we don't need
+		if key.Type != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.Modulus)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key.ID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.Exponent)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key.ID, err)
+		}
+		keys[key.ID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	s.keys = keys
+	s.fetched = time.Now()
+	return nil
+}
+
+// a claim that's either a single string or a list of them
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+// the claims of an sso access token we care about
+type tokenClaims struct {
+	// "CHARACTER:EVE:<id>"
+	Subject  string     `json:"sub"`
+	Name     string     `json:"name"`
+	Scopes   stringList `json:"scp"`
+	Issuer   string     `json:"iss"`
+	Audience stringList `json:"aud"`
+	Expiry   int64      `json:"exp"`
+}
+
+// check the signature and the claims of an access token and find out whose it is
+func (f *Fetcher) verifyAccessToken(token string) (*orderbookfetcher.Character, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a jwt", ErrInvalidToken)
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm != "RS256" {
+		return nil, fmt.Errorf("%w: unexpected algorithm %q", ErrInvalidToken, header.Algorithm)
+	}
+	key, err := f.keys.key(f.client, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims tokenClaims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > claims.Expiry {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if issuerHost(claims.Issuer) != issuerHost(f.config.SSOURL) {
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalidToken, claims.Issuer)
+	}
+	if !contains(claims.Audience, f.config.ClientID) {
+		return nil, fmt.Errorf("%w: issued for another application", ErrInvalidToken)
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(claims.Subject, "CHARACTER:EVE:"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unexpected subject %q", ErrInvalidToken, claims.Subject)
+	}
+	return &orderbookfetcher.Character{ID: id, Name: claims.Name, Scopes: claims.Scopes}, nil
+}
+
+// make sure the access token is fit for fetching citadels and remember whose it is
+func (f *Fetcher) checkAccessToken() error {
+	character, err := f.verifyAccessToken(f.currentToken().AccessToken)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, scope := range Scopes {
+		if !contains(character.Scopes, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the token of %s is missing the scopes %s, log in again with the login command",
+			character.Name, strings.Join(missing, ", "))
+	}
+
+	f.mu.Lock()
+	changed := f.character == nil || f.character.ID != character.ID
+	f.character = character
+	f.mu.Unlock()
+	if changed {
+		log.Printf("using the character %s (%d)", character.Name, character.ID)
+	}
+	return nil
+}
+
+// decode a base64 encoded json part of a jwt
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	return nil
+}
+
+// the sso puts its host into the issuer, with or without the scheme
+func issuerHost(issuer string) string {
+	if u, err := url.Parse(issuer); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return issuer
+}
+
+func contains(list []string, s string) bool {
+	for _, element := range list {
+		if element == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package esi
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// a jwks endpoint serving the public keys of its signing keys
+type fakeJWKS struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	keys     map[string]*rsa.PrivateKey
+	requests int
+}
+
+func newFakeJWKS(t *testing.T) *fakeJWKS {
+	jwks := &fakeJWKS{keys: map[string]*rsa.PrivateKey{"key-1": newSigningKey(t)}}
+	jwks.Server = httptest.NewServer(http.HandlerFunc(jwks.serve))
+	t.Cleanup(jwks.Close)
+	return jwks
+}
+
+func (jwks *fakeJWKS) serve(w http.ResponseWriter, r *http.Request) {
+	jwks.mu.Lock()
+	defer jwks.mu.Unlock()
+	jwks.requests++
+	type jwk struct {
+		ID       string `json:"kid"`
+		Type     string `json:"kty"`
+		Modulus  string `json:"n,omitempty"`
+		Exponent string `json:"e,omitempty"`
+	}
+	// the sso publishes an ES256 key as well
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{Keys: []jwk{{ID: "es256", Type: "EC"}}}
+	for id, key := range jwks.keys {
+		set.Keys = append(set.Keys, jwk{
+			ID:       id,
+			Type:     "RSA",
+			Modulus:  base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			Exponent: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	json.NewEncoder(w).Encode(&set)
+}
+
+// how often the keys have been fetched
+func (jwks *fakeJWKS) fetches() int {
+	jwks.mu.Lock()
+	defer jwks.mu.Unlock()
+	return jwks.requests
+}
+
+func newSigningKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// claims of a token the fake sso would hand out for our application
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub":  "CHARACTER:EVE:2112625428",
+		"name": "Some Trader",
+		"scp":  []string{"esi-markets.structure_markets.v1", "esi-universe.read_structures.v1"},
+		"iss":  "https://login.eveonline.com",
+		"aud":  []string{"client", "EVE Online"},
+		"exp":  time.Now().Add(20 * time.Minute).Unix(),
+	}
+}
+
+// sign the claims with the key like the sso does
+func signToken(t *testing.T, key *rsa.PrivateKey, algorithm, keyID string, claims map[string]any) string {
+	t.Helper()
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(map[string]string{"alg": algorithm, "kid": keyID, "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newJWTFetcher(jwks *fakeJWKS) *Fetcher {
+	return NewFetcher(&orderbookfetcher.Configuration{
+		SSOURL:   "https://login.eveonline.com",
+		JWKSURL:  jwks.URL,
+		ClientID: "client",
+	})
+}
+
+func TestVerifyAccessToken(t *testing.T) {
+	jwks := newFakeJWKS(t)
+	key := jwks.keys["key-1"]
+	otherKey := newSigningKey(t)
+	with := func(name string, value any) map[string]any {
+		claims := validClaims()
+		claims[name] = value
+		return claims
+	}
+
+	for _, test := range []struct {
+		name  string
+		token string
+		// part of the error, valid if empty
+		err string
+	}{
+		{name: "valid", token: signToken(t, key, "RS256", "key-1", validClaims())},
+		{name: "issuer without scheme", token: signToken(t, key, "RS256", "key-1", with("iss", "login.eveonline.com"))},
+		{name: "bad signature", token: signToken(t, otherKey, "RS256", "key-1", validClaims()), err: "bad signature"},
+		{name: "tampered claims", token: tamper(signToken(t, key, "RS256", "key-1", validClaims())), err: "bad signature"},
+		{name: "another algorithm", token: signToken(t, key, "HS256", "key-1", validClaims()), err: "unexpected algorithm"},
+		{name: "no algorithm", token: signToken(t, key, "none", "key-1", validClaims()), err: "unexpected algorithm"},
+		{name: "expired", token: signToken(t, key, "RS256", "key-1", with("exp", time.Now().Add(-time.Minute).Unix())), err: "expired"},
+		{name: "another issuer", token: signToken(t, key, "RS256", "key-1", with("iss", "https://login.example.com")), err: "issued by"},
+		{name: "another application", token: signToken(t, key, "RS256", "key-1", with("aud", "another client")), err: "another application"},
+		{name: "not a character", token: signToken(t, key, "RS256", "key-1", with("sub", "CORPORATION:EVE:1")), err: "unexpected subject"},
+		{name: "not a jwt", token: "access", err: "not a jwt"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := newJWTFetcher(jwks)
+			character, err := f.verifyAccessToken(test.token)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if character.ID != 2112625428 || character.Name != "Some Trader" || len(character.Scopes) != 2 {
+					t.Errorf("unexpected character %+v", character)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected an invalid token (%s), got %v", test.err, err)
+			}
+		})
+	}
+}
+
+// change the claims without signing them again
+func tamper(token string) string {
+	parts := strings.Split(token, ".")
+	claims := validClaims()
+	claims["sub"] = "CHARACTER:EVE:1"
+	data, _ := json.Marshal(claims)
+	parts[1] = base64.RawURLEncoding.EncodeToString(data)
+	return strings.Join(parts, ".")
+}
+
+func TestVerifyAccessTokenUnknownKey(t *testing.T) {
+	jwks := newFakeJWKS(t)
+	f := newJWTFetcher(jwks)
+	if _, err := f.verifyAccessToken(signToken(t, jwks.keys["key-1"], "RS256", "key-1", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sso starts to sign with a new key
+	newKey := newSigningKey(t)
+	jwks.mu.Lock()
+	jwks.keys["key-2"] = newKey
+	jwks.mu.Unlock()
+	token := signToken(t, newKey, "RS256", "key-2", validClaims())
+
+	// an unknown key id doesn't get the keys fetched over and over again
+	if _, err := f.verifyAccessToken(token); !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), "unknown key") {
+		t.Errorf("expected the unknown key to be refused, got %v", err)
+	}
+	if n := jwks.fetches(); n != 1 {
+		t.Errorf("expected the keys to be fetched once within the retry delay, got %d", n)
+	}
+
+	// once the delay has passed they are fetched again
+	f.keys.mu.Lock()
+	f.keys.fetched = f.keys.fetched.Add(-jwksRetryDelay)
+	f.keys.mu.Unlock()
+	if _, err := f.verifyAccessToken(token); err != nil {
+		t.Errorf("expected the new key to be picked up, got %v", err)
+	}
+	if n := jwks.fetches(); n != 2 {
+		t.Errorf("expected the keys to be fetched again, got %d fetches", n)
+	}
+}
+
+func TestVerifyAccessTokenCachedKey(t *testing.T) {
+	jwks := newFakeJWKS(t)
+	f := newJWTFetcher(jwks)
+	token := signToken(t, jwks.keys["key-1"], "RS256", "key-1", validClaims())
+	if _, err := f.verifyAccessToken(token); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cache has expired, but the keys can't be fetched
+	jwks.Close()
+	f.keys.mu.Lock()
+	f.keys.fetched = f.keys.fetched.Add(-jwksCacheDuration)
+	f.keys.mu.Unlock()
+	if _, err := f.verifyAccessToken(token); err != nil {
+		t.Errorf("expected the cached key to be used, got %v", err)
+	}
+}
+
+func TestCheckAccessTokenScopes(t *testing.T) {
+	jwks := newFakeJWKS(t)
+	f := newJWTFetcher(jwks)
+	claims := validClaims()
+	claims["scp"] = "esi-markets.structure_markets.v1"
+	f.setToken(&orderbookfetcher.Token{AccessToken: signToken(t, jwks.keys["key-1"], "RS256", "key-1", claims)})
+	if err := f.checkAccessToken(); err == nil || !strings.Contains(err.Error(), "esi-universe.read_structures.v1") {
+		t.Errorf("expected the token without the structure scope to be refused, got %v", err)
+	}
+	if f.character != nil {
+		t.Error("the character of a refused token is used")
+	}
+
+	f.setToken(&orderbookfetcher.Token{AccessToken: signToken(t, jwks.keys["key-1"], "RS256", "key-1", validClaims())})
+	if err := f.checkAccessToken(); err != nil {
+		t.Fatal(err)
+	}
+	if f.character == nil || f.character.ID != 2112625428 {
+		t.Errorf("unexpected character %+v", f.character)
+	}
+}
@@ -0,0 +1,126 @@
+package esi
+
+import (
+	"container/heap"
+	"errors"
+	"log"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+var (
+	ErrLocationExists  = errors.New("location is already being fetched")
+	ErrUnknownLocation = errors.New("location isn't being fetched")
+	ErrFetching        = errors.New("location is being fetched right now")
+	ErrNoRefreshToken  = errors.New("fetching citadels requires a client id and refresh token, log in with the login command")
+)
+
+// start fetching a location while the fetcher is running, it gets fetched right away
+func (f *Fetcher) AddLocation(location orderbookfetcher.LocationConfig, isCitadel bool) error {
+	f.mu.RLock()
+	_, exists := f.requests[location.ID]
+	f.mu.RUnlock()
+	if exists {
+		return ErrLocationExists
+	}
+
+	// we need an access token to look up the name of a citadel
+	if isCitadel {
+		if err := f.ensureTokenRefresher(); err != nil {
+			return err
+		}
+	}
+	name, err := f.configuredName(location, isCitadel)
+	if err != nil {
+		return err
+	}
+	request := newFetchRequest(location, isCitadel)
+	f.mu.RLock()
+	directory := f.directory(request)
+	f.mu.RUnlock()
+	// the location might have been fetched before
+	fileNames, infos := storedOrderbooks(directory, location.ID, isCitadel, name)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// somebody might have been quicker
+	if _, exists := f.requests[location.ID]; exists {
+		return ErrLocationExists
+	}
+	log.Printf("%d - %s", location.ID, name)
+	f.Locations[location.ID] = name
+	f.seedOrderbooks(request, fileNames, infos)
+	f.requests[location.ID] = request
+	heap.Push(&f.pq, request)
+	f.wakeWorker()
+	return nil
+}
+
+// stop fetching a location, the orderbooks that have been written stay on disk
+func (f *Fetcher) RemoveLocation(location uint64) error {
+	f.mu.Lock()
+	request, ok := f.requests[location]
+	if !ok {
+		f.mu.Unlock()
+		return ErrUnknownLocation
+	}
+	// the worker doesn't put it back into the queue if it's working on it right now
+	request.removed = true
+	if request.index >= 0 {
+		heap.Remove(&f.pq, request.index)
+	}
+	name := f.Locations[location]
+	delete(f.requests, location)
+	delete(f.Locations, location)
+	f.wakeWorker()
+	f.mu.Unlock()
+
+	log.Printf("removed location %d", location)
+	f.emit(&orderbookfetcher.Event{
+		Type:         orderbookfetcher.EventLocationRemoved,
+		LocationID:   location,
+		LocationName: name,
+	})
+	return nil
+}
+
+// fetch a location right away, even if it would be skipped
+func (f *Fetcher) FetchNow(location uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	request, ok := f.requests[location]
+	if !ok {
+		return ErrUnknownLocation
+	}
+	if request.index < 0 {
+		return ErrFetching
+	}
+	request.force = true
+	request.Expiry = time.Now()
+	heap.Fix(&f.pq, request.index)
+	f.wakeWorker()
+	return nil
+}
+
+// get an access token and keep it refreshed, unless that is already happening
+func (f *Fetcher) ensureTokenRefresher() error {
+	f.tokenMu.Lock()
+	defer f.tokenMu.Unlock()
+	if f.refreshing {
+		return nil
+	}
+	if err := f.initTokens(); err != nil {
+		return err
+	}
+	f.startTokenRefresher()
+	return nil
+}
+
+// tell the worker that the queue has changed
+func (f *Fetcher) wakeWorker() {
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,97 @@
+package esi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// a location from the configuration
+type configuredLocation struct {
+	id        uint64
+	isCitadel bool
+}
+
+// apply the locations and their options, the interval and retention policies of a new configuration to the running fetcher.
+// fetches that are in flight finish, if a location can't be added nothing gets applied
+func (f *Fetcher) Reload(config *orderbookfetcher.Configuration) error {
+	f.mu.RLock()
+	added, removed := diffLocations(f.config, config)
+	f.mu.RUnlock()
+	after := configuredLocations(config)
+
+	// adding can fail (unknown locations, no token), so it goes first and gets undone if it does
+	var done []uint64
+	for _, location := range added {
+		err := f.AddLocation(after[location], location.isCitadel)
+		if errors.Is(err, ErrLocationExists) {
+			// has been added through the admin api before
+			continue
+		} else if err != nil {
+			for _, id := range done {
+				f.RemoveLocation(id)
+			}
+			return fmt.Errorf("failed to add location %d: %w", location.id, err)
+		}
+		done = append(done, location.id)
+	}
+	for _, location := range removed {
+		// might have been removed through the admin api before
+		if err := f.RemoveLocation(location.id); err != nil && !errors.Is(err, ErrUnknownLocation) {
+			log.Printf("failed to remove location %d: %s", location.id, err)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.config.Regions = append([]orderbookfetcher.LocationConfig(nil), config.Regions...)
+	f.config.Citadels = append([]orderbookfetcher.LocationConfig(nil), config.Citadels...)
+	f.config.OrderbookDirectory = config.OrderbookDirectory
+	f.config.Interval = config.Interval
+	f.config.Staleness = config.Staleness
+	f.config.RetentionPeriod = config.RetentionPeriod
+	f.config.Retention = config.Retention
+	for _, request := range f.requests {
+		// the overrides of the locations that are kept might have changed
+		if location, ok := after[configuredLocation{id: request.LocationID, isCitadel: request.IsCitadel}]; ok {
+			request.Config = location
+			if location.Name != "" {
+				f.Locations[request.LocationID] = location.Name
+			}
+		}
+		// a smaller retention period applies right away
+		f.enforceRetention(request)
+	}
+	log.Printf("reloaded the configuration: %d location(s) added, %d removed", len(done), len(removed))
+	return nil
+}
+
+// which locations are in the new configuration but not the old one and the other way around
+func diffLocations(old, new *orderbookfetcher.Configuration) (added, removed []configuredLocation) {
+	before, after := configuredLocations(old), configuredLocations(new)
+	for location := range after {
+		if _, ok := before[location]; !ok {
+			added = append(added, location)
+		}
+	}
+	for location := range before {
+		if _, ok := after[location]; !ok {
+			removed = append(removed, location)
+		}
+	}
+	return added, removed
+}
+
+// the options of the locations in the configuration
+func configuredLocations(config *orderbookfetcher.Configuration) map[configuredLocation]orderbookfetcher.LocationConfig {
+	locations := make(map[configuredLocation]orderbookfetcher.LocationConfig, len(config.Regions)+len(config.Citadels))
+	for _, location := range config.Regions {
+		locations[configuredLocation{id: location.ID}] = location
+	}
+	for _, location := range config.Citadels {
+		locations[configuredLocation{id: location.ID, isCitadel: true}] = location
+	}
+	return locations
+}
@@ -0,0 +1,173 @@
+package esi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// what the fetcher needs to read the citadel markets and names
+var Scopes = []string{"esi-markets.structure_markets.v1", "esi-universe.read_structures.v1"}
+
+// logs a character in through sso with the authorization code flow and pkce,
+// which doesn't need the secret of the application
+type Login struct {
+	// base url of the sso, e.g. "https://login.eveonline.com"
+	SSOURL   string
+	ClientID string
+	// where sso sends the user back to, has to be the callback url of the application.
+	// a listener is started on its host for the duration of the login
+	CallbackURL string
+	Scopes      []string
+	// gets the url the user has to open to log in
+	OpenURL func(authorizeURL string)
+
+	client *http.Client
+}
+
+func NewLogin(ssoURL, clientID, callbackURL string) *Login {
+	return &Login{
+		SSOURL:      ssoURL,
+		ClientID:    clientID,
+		CallbackURL: callbackURL,
+		Scopes:      Scopes,
+		OpenURL:     func(string) {},
+		client:      http.DefaultClient,
+	}
+}
+
+// wait for the user to log in and exchange the code for the tokens,
+// gives up once the context is cancelled
+func (l *Login) Run(ctx context.Context) (*orderbookfetcher.Token, error) {
+	callback, err := url.Parse(l.CallbackURL)
+	if err != nil || callback.Host == "" {
+		return nil, fmt.Errorf("invalid callback url %q", l.CallbackURL)
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", callback.Host)
+	if err != nil {
+		return nil, err
+	}
+	codes := make(chan string, 1)
+	failures := make(chan error, 1)
+	router := http.NewServeMux()
+	router.HandleFunc(callbackPath(callback), func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case query.Get("state") != state:
+			http.Error(w, "unexpected state, start the login again", http.StatusBadRequest)
+			return
+		case query.Get("error") != "":
+			fmt.Fprintf(w, "login failed: %s", html.EscapeString(query.Get("error")))
+			failures <- fmt.Errorf("login failed: %s", query.Get("error"))
+			return
+		case query.Get("code") == "":
+			http.Error(w, "no code", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintln(w, "logged in, you can close this window")
+		select {
+		case codes <- query.Get("code"):
+		default:
+		}
+	})
+	server := &http.Server{Handler: router, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(ln)
+	defer func() {
+		// let the callback finish its page, browsers tend to keep unused connections open though
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if server.Shutdown(ctx) != nil {
+			server.Close()
+		}
+	}()
+
+	l.OpenURL(l.authorizeURL(state, challenge(verifier)))
+	select {
+	case code := <-codes:
+		return l.exchange(code, verifier)
+	case err := <-failures:
+		return nil, err
+	case <-ctx.Done():
+		return nil, errors.New("gave up waiting for the login")
+	}
+}
+
+// the page the user logs in on
+func (l *Login) authorizeURL(state, challenge string) string {
+	query := url.Values{
+		"response_type":         []string{"code"},
+		"redirect_uri":          []string{l.CallbackURL},
+		"client_id":             []string{l.ClientID},
+		"scope":                 []string{strings.Join(l.Scopes, " ")},
+		"code_challenge":        []string{challenge},
+		"code_challenge_method": []string{"S256"},
+		"state":                 []string{state},
+	}
+	return strings.TrimSuffix(l.SSOURL, "/") + "/v2/oauth/authorize?" + query.Encode()
+}
+
+// trade the code from the callback for the tokens
+func (l *Login) exchange(code, verifier string) (*orderbookfetcher.Token, error) {
+	tokens, err := requestTokens(l.client, l.SSOURL, url.Values{
+		"grant_type":    []string{"authorization_code"},
+		"code":          []string{code},
+		"client_id":     []string{l.ClientID},
+		"code_verifier": []string{verifier},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tokens.RefreshToken == "" {
+		return nil, errors.New("sso didn't return a refresh token")
+	}
+	log.Println("logged in")
+	return &orderbookfetcher.Token{
+		RefreshToken: tokens.RefreshToken,
+		AccessToken:  tokens.AccessToken,
+		Expiry:       tokens.Expiry(),
+	}, nil
+}
+
+// the path the callback is served at
+func callbackPath(callback *url.URL) string {
+	if callback.Path == "" {
+		return "/"
+	}
+	return callback.Path
+}
+
+// 32 random bytes, used for the pkce verifier and the state
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// the pkce challenge of the verifier (S256)
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,200 @@
+package esi
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// an sso that hands out tokens for the code it has issued,
+// as long as the verifier matches the challenge of the authorization request
+type fakeSSO struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	challenge string
+	expiresIn uint
+	exchanges int
+}
+
+func newFakeSSO(t *testing.T) *fakeSSO {
+	sso := &fakeSSO{expiresIn: 1199}
+	sso.Server = httptest.NewServer(http.HandlerFunc(sso.token))
+	t.Cleanup(sso.Close)
+	return sso
+}
+
+func (sso *fakeSSO) token(w http.ResponseWriter, r *http.Request) {
+	sso.mu.Lock()
+	defer sso.mu.Unlock()
+	sso.exchanges++
+	if r.URL.Path != "/v2/oauth/token" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code",
+		r.PostForm.Get("code") != "the-code",
+		r.PostForm.Get("client_id") != "client":
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	case challenge(r.PostForm.Get("code_verifier")) != sso.challenge:
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(&ESITokens{
+		AccessToken:  "access",
+		ExpiresIn:    sso.expiresIn,
+		TokenType:    "Bearer",
+		RefreshToken: "refresh",
+	})
+}
+
+// a callback url on a free port
+func freeCallbackURL(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return "http://" + ln.Addr().String() + "/callback"
+}
+
+// calls the callback like the browser does after logging in
+func callback(t *testing.T, callbackURL string, query url.Values) int {
+	t.Helper()
+	resp, err := http.Get(callbackURL + "?" + query.Encode())
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestLogin(t *testing.T) {
+	sso := newFakeSSO(t)
+	login := NewLogin(sso.URL, "client", freeCallbackURL(t))
+	login.OpenURL = func(authorizeURL string) {
+		u, err := url.Parse(authorizeURL)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		query := u.Query()
+		if u.Path != "/v2/oauth/authorize" || query.Get("client_id") != "client" || query.Get("redirect_uri") != login.CallbackURL {
+			t.Errorf("unexpected authorize url %s", authorizeURL)
+		}
+		if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+			t.Errorf("the authorize url is missing the pkce challenge: %s", authorizeURL)
+		}
+		if scope := query.Get("scope"); scope != strings.Join(Scopes, " ") {
+			t.Errorf("unexpected scope %q", scope)
+		}
+		sso.mu.Lock()
+		sso.challenge = query.Get("code_challenge")
+		sso.mu.Unlock()
+
+		go func() {
+			// someone else's callback has to be turned away
+			if status := callback(t, login.CallbackURL, url.Values{"code": {"forged"}, "state": {"wrong"}}); status != http.StatusBadRequest {
+				t.Errorf("a callback with the wrong state got status %d", status)
+			}
+			if status := callback(t, login.CallbackURL, url.Values{"code": {"the-code"}, "state": {query.Get("state")}}); status != http.StatusOK {
+				t.Errorf("the callback got status %d", status)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	token, err := login.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.RefreshToken != "refresh" || token.AccessToken != "access" {
+		t.Errorf("unexpected token %+v", token)
+	}
+	if until := time.Until(token.Expiry); until < 1180*time.Second || until > 1199*time.Second {
+		t.Errorf("unexpected expiry in %s", until)
+	}
+	sso.mu.Lock()
+	if sso.exchanges != 1 {
+		t.Errorf("expected the code to be exchanged once, got %d", sso.exchanges)
+	}
+	sso.mu.Unlock()
+
+	// what the login command does with it
+	fileName := filepath.Join(t.TempDir(), "data", "token.json")
+	store := NewFileTokenStore(fileName)
+	if err = store.SaveToken(token); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := stat.Mode().Perm(); perm != 0600 {
+		t.Errorf("the token file is readable by others: %s", perm)
+	}
+	stored, err := store.LoadToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.RefreshToken != token.RefreshToken || stored.AccessToken != token.AccessToken || !stored.Expiry.Equal(token.Expiry) {
+		t.Errorf("stored %+v, expected %+v", stored, token)
+	}
+}
+
+func TestLoginDenied(t *testing.T) {
+	sso := newFakeSSO(t)
+	login := NewLogin(sso.URL, "client", freeCallbackURL(t))
+	login.OpenURL = func(authorizeURL string) {
+		u, _ := url.Parse(authorizeURL)
+		go callback(t, login.CallbackURL, url.Values{"error": {"access_denied"}, "state": {u.Query().Get("state")}})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := login.Run(ctx); err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("expected the denied login to fail, got %v", err)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	sso := newFakeSSO(t)
+	sso.challenge = challenge("the verifier")
+	login := NewLogin(sso.URL, "client", "http://127.0.0.1/callback")
+	if _, err := login.exchange("the-code", "another verifier"); err == nil {
+		t.Error("expected the exchange with the wrong verifier to fail")
+	}
+	if _, err := login.exchange("the-code", "the verifier"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExchangeShortExpiry(t *testing.T) {
+	sso := newFakeSSO(t)
+	sso.challenge = challenge("the verifier")
+	sso.expiresIn = 3
+	login := NewLogin(sso.URL, "client", "http://127.0.0.1/callback")
+	token, err := login.exchange("the-code", "the verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(token.Expiry); until > time.Second || until < -time.Second {
+		t.Errorf("expected the token to expire right away, expires in %s", until)
+	}
+}
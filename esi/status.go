@@ -0,0 +1,228 @@
+package esi
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// how long esi caches the market orders, a location expires this often
+const esiCacheDuration = 5 * time.Minute
+
+// the current state of every location, ordered by the next fetch
+func (f *Fetcher) Status() *orderbookfetcher.FetcherStatus {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	status := &orderbookfetcher.FetcherStatus{
+		Started:   f.started,
+		Interval:  f.config.Interval,
+		Locations: make([]*orderbookfetcher.LocationStatus, 0, len(f.requests)),
+		Character: f.character,
+	}
+	for _, request := range f.requests {
+		location := &orderbookfetcher.LocationStatus{
+			LocationID:   request.LocationID,
+			LocationName: f.Locations[request.LocationID],
+			IsCitadel:    request.IsCitadel,
+			NextFetch:    request.Expiry,
+			Skipped:      request.Skipped,
+			SkippedTotal: request.SkippedTotal,
+			LastError:    request.LastError,
+		}
+		if location.Skipped < 0 {
+			// hasn't been fetched yet
+			location.Skipped = 0
+		}
+		if !request.LastWritten.IsZero() {
+			location.LastSnapshot = timePtr(request.LastWritten)
+		}
+		if !request.LastErrorTime.IsZero() {
+			location.LastErrorTime = timePtr(request.LastErrorTime)
+		}
+		status.Locations = append(status.Locations, location)
+	}
+	sort.Slice(status.Locations, func(i, j int) bool {
+		return status.Locations[i].NextFetch.Before(status.Locations[j].NextFetch)
+	})
+	return status
+}
+
+// copy of the location names by id
+func (f *Fetcher) LocationNames() map[uint64]string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	names := make(map[uint64]string, len(f.Locations))
+	for id, name := range f.Locations {
+		names[id] = name
+	}
+	return names
+}
+
+// copy of the orderbooks on disk by file name, including the ones of previous runs
+func (f *Fetcher) Orderbooks() map[string]*orderbookfetcher.OrderbookInfo {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	orderbooks := make(map[string]*orderbookfetcher.OrderbookInfo, len(f.WrittenOrderbooks))
+	for fileName, info := range f.WrittenOrderbooks {
+		orderbooks[fileName] = info
+	}
+	return orderbooks
+}
+
+// look up the name of a location
+func (f *Fetcher) locationName(location uint64) string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.Locations[location]
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// the newest orderbook of a location on disk
+func (f *Fetcher) LatestOrderbook(location uint64) (string, *orderbookfetcher.OrderbookInfo, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var latestFile string
+	var latest *orderbookfetcher.OrderbookInfo
+	for fileName, info := range f.WrittenOrderbooks {
+		if info.LocationID == location && (latest == nil || info.Date.After(latest.Date)) {
+			latestFile, latest = fileName, info
+		}
+	}
+	return latestFile, latest, latest != nil
+}
+
+// where the orderbooks of a location are written to, the global directory if it isn't being fetched
+func (f *Fetcher) OrderbookDirectory(location uint64) string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if request, ok := f.requests[location]; ok {
+		return f.directory(request)
+	}
+	return f.config.OrderbookDirectory
+}
+
+// when the esi data of the location expires next
+func (f *Fetcher) NextExpiry(location uint64) (time.Time, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	request, ok := f.requests[location]
+	if !ok {
+		return time.Time{}, false
+	}
+	return request.Expiry, true
+}
+
+// snapshot of the counters, for the metrics endpoint
+func (f *Fetcher) Metrics() *orderbookfetcher.FetcherMetrics {
+	f.mu.RLock()
+
+	metrics := &orderbookfetcher.FetcherMetrics{
+		Responses:            make(map[int]uint, len(f.responses)),
+		RequestErrors:        f.requestErrors,
+		ErrorLimitRemain:     f.errorLimitRemain,
+		TokenRefreshes:       f.tokenRefreshes,
+		TokenRefreshFailures: f.tokenRefreshFailures,
+		Locations:            make([]*orderbookfetcher.LocationMetrics, 0, len(f.requests)),
+	}
+	for code, count := range f.responses {
+		metrics.Responses[code] = count
+	}
+	// the files are looked at once we've let go of the lock, there can be thousands of them
+	files := make(map[*orderbookfetcher.LocationMetrics][]string, len(f.requests))
+	for _, request := range f.requests {
+		location := request.metrics
+		location.LocationID = request.LocationID
+		location.LocationName = f.Locations[request.LocationID]
+		location.IsCitadel = request.IsCitadel
+		location.NextExpiry = request.Expiry
+		files[&location] = append([]string(nil), request.FilesWritten...)
+		metrics.Locations = append(metrics.Locations, &location)
+	}
+	f.mu.RUnlock()
+
+	for location, fileNames := range files {
+		for _, fileName := range fileNames {
+			if fileName == "" {
+				continue
+			}
+			if stat, err := os.Stat(fileName); err == nil {
+				location.DiskBytes += stat.Size()
+			}
+		}
+	}
+	sort.Slice(metrics.Locations, func(i, j int) bool {
+		return metrics.Locations[i].LocationID < metrics.Locations[j].LocationID
+	})
+	return metrics
+}
+
+// count the outcome of a token refresh
+func (f *Fetcher) countTokenRefresh(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		f.tokenRefreshFailures++
+	} else {
+		f.tokenRefreshes++
+	}
+}
+
+// is the fetcher still working and are the orderbooks fresh?
+func (f *Fetcher) Readiness() *orderbookfetcher.Readiness {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	readiness := &orderbookfetcher.Readiness{}
+	if f.workerExit != "" {
+		readiness.Problems = append(readiness.Problems, "worker stopped: "+f.workerExit)
+	}
+	if f.refresherExit != "" {
+		readiness.Problems = append(readiness.Problems, "token refresher stopped: "+f.refresherExit)
+	}
+
+	ids := make([]uint64, 0, len(f.requests))
+	for id := range f.requests {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		request := f.requests[id]
+		// we write an orderbook every interval esi expiries, locations can have their own interval
+		interval := f.interval(request)
+		if interval < 1 {
+			interval = 1
+		}
+		maxAge := time.Duration(f.config.Staleness * float64(time.Duration(interval)*esiCacheDuration))
+		// locations that haven't been written yet count from the start
+		last := f.started
+		if request.LastWritten.After(last) {
+			last = request.LastWritten
+		}
+		if age := time.Since(last); age > maxAge {
+			readiness.Problems = append(readiness.Problems, fmt.Sprintf(
+				"newest orderbook of location %d is %s old (allowed: %s)",
+				id, age.Round(time.Second), maxAge,
+			))
+		}
+	}
+	readiness.Ready = len(readiness.Problems) == 0
+	return readiness
+}
+
+// is the location a citadel? known is false if it isn't being fetched
+func (f *Fetcher) LocationKind(location uint64) (isCitadel bool, known bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	request, ok := f.requests[location]
+	if !ok {
+		return false, false
+	}
+	return request.IsCitadel, true
+}
@@ -0,0 +1,62 @@
+package esi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// assure interface compliance
+var _ orderbookfetcher.TokenStore = (*FileTokenStore)(nil)
+
+// keeps the tokens in a json file only the owner can read
+type FileTokenStore struct {
+	fileName string
+}
+
+func NewFileTokenStore(fileName string) *FileTokenStore {
+	return &FileTokenStore{fileName: fileName}
+}
+
+// the stored token, nil if the file doesn't exist yet
+func (s *FileTokenStore) LoadToken() (*orderbookfetcher.Token, error) {
+	data, err := os.ReadFile(s.fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var token *orderbookfetcher.Token
+	if err = json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// replace the stored token in one go, so a crash can't leave us without a refresh token
+func (s *FileTokenStore) SaveToken(token *orderbookfetcher.Token) error {
+	dir := filepath.Dir(s.fileName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	// created with 0600
+	file, err := os.CreateTemp(dir, filepath.Base(s.fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err = json.NewEncoder(file).Encode(token); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), s.fileName)
+}
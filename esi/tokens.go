@@ -3,9 +3,13 @@ package esi
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
 )
 
 type ESITokens struct {
@@ -15,30 +19,44 @@ type ESITokens struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+// when the access token runs out, with a few seconds to spare
+func (t *ESITokens) Expiry() time.Time {
+	expiresIn := t.ExpiresIn
+	if expiresIn > 5 {
+		expiresIn -= 5
+	} else {
+		expiresIn = 0
+	}
+	return time.Now().Add(time.Second * time.Duration(expiresIn))
+}
+
 // refreshes our access token
-// using the refresh token from the configuration
+// using the latest refresh token
 func (f *Fetcher) RefreshToken() (*ESITokens, error) {
-	form := url.Values{
+	return requestTokens(f.client, f.config.SSOURL, url.Values{
 		"grant_type":    []string{"refresh_token"},
-		"refresh_token": []string{f.config.RefreshToken},
+		"refresh_token": []string{f.currentToken().RefreshToken},
 		"client_id":     []string{f.config.ClientID},
-	}
+	})
+}
 
-	request, err := http.NewRequest(http.MethodPost, "https://login.eveonline.com/v2/oauth/token", strings.NewReader(form.Encode()))
+// post the form to the token endpoint of the sso
+func requestTokens(client *http.Client, ssoURL string, form url.Values) (*ESITokens, error) {
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(ssoURL, "/")+"/v2/oauth/token", strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, err
 	}
 
 	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	request.Header.Set("Host", "login.eveonline.com")
 
-	response, err := f.client.Do(request)
+	response, err := client.Do(request)
 	if err != nil {
 		return nil, err
-	} else if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request returned status: %s", response.Status)
 	}
 	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request returned status: %s", response.Status)
+	}
 
 	var tokens *ESITokens
 	if err = json.NewDecoder(response.Body).Decode(&tokens); err != nil {
@@ -46,3 +64,101 @@ func (f *Fetcher) RefreshToken() (*ESITokens, error) {
 	}
 	return tokens, nil
 }
+
+// pick up the tokens of the last run, the access token is only refreshed if it has expired.
+// the stored refresh token takes precedence over the configured one, unless the configuration
+// has another refresh token than the one the tokens were stored with
+func (f *Fetcher) initTokens() error {
+	// tried if the refresh token we went with is rejected
+	var fallback string
+	if f.TokenStore != nil {
+		token, err := f.TokenStore.LoadToken()
+		switch {
+		case err != nil:
+			log.Printf("failed to load the stored token: %s", err)
+		case token == nil || token.RefreshToken == "":
+		case f.config.RefreshToken != "" && token.ConfigToken != orderbookfetcher.HashRefreshToken(f.config.RefreshToken):
+			log.Println("the refresh token in the configuration has changed, using it instead of the stored one")
+			fallback = token.RefreshToken
+		default:
+			fallback = f.config.RefreshToken
+			f.setToken(&orderbookfetcher.Token{RefreshToken: token.RefreshToken})
+			if time.Until(token.Expiry) > time.Minute {
+				f.setToken(token)
+				err := f.checkAccessToken()
+				if err == nil {
+					log.Println("using the stored access token")
+					return nil
+				}
+				log.Printf("can't use the stored access token: %s", err)
+			}
+		}
+	}
+	if f.config.ClientID == "" || f.currentToken().RefreshToken == "" {
+		return ErrNoRefreshToken
+	}
+	err := f.renewTokens()
+	if err != nil && fallback != "" && fallback != f.currentToken().RefreshToken {
+		log.Printf("the refresh token has been rejected (%s), trying the other one", err)
+		f.setToken(&orderbookfetcher.Token{RefreshToken: fallback})
+		err = f.renewTokens()
+	}
+	if err != nil {
+		return err
+	}
+	// refuse to start with a token that won't get us the citadels
+	return f.checkAccessToken()
+}
+
+// get a new access token and store the tokens
+func (f *Fetcher) renewTokens() error {
+	tokens, err := f.RefreshToken()
+	f.countTokenRefresh(err)
+	if err != nil {
+		return err
+	}
+	// the old refresh token stops working once sso has rotated it
+	token := f.setToken(&orderbookfetcher.Token{
+		RefreshToken: tokens.RefreshToken,
+		AccessToken:  tokens.AccessToken,
+		Expiry:       tokens.Expiry(),
+	})
+	token.ConfigToken = orderbookfetcher.HashRefreshToken(f.config.RefreshToken)
+	if f.TokenStore != nil {
+		if err = f.TokenStore.SaveToken(token); err != nil {
+			log.Printf("failed to store the tokens: %s", err)
+		}
+	}
+	return nil
+}
+
+// copy of the tokens we are using
+func (f *Fetcher) currentToken() *orderbookfetcher.Token {
+	f.tokensMu.RLock()
+	defer f.tokensMu.RUnlock()
+	return &orderbookfetcher.Token{
+		RefreshToken: f.refreshToken,
+		AccessToken:  f.accessToken,
+		Expiry:       f.tokenExpiry,
+	}
+}
+
+// use the access token from now on, the refresh token is kept if the token doesn't have one.
+// returns a copy of the tokens we are using now
+func (f *Fetcher) setToken(token *orderbookfetcher.Token) *orderbookfetcher.Token {
+	f.tokensMu.Lock()
+	f.accessToken = token.AccessToken
+	f.tokenExpiry = token.Expiry
+	if token.RefreshToken != "" {
+		f.refreshToken = token.RefreshToken
+	}
+	f.tokensMu.Unlock()
+	return f.currentToken()
+}
+
+// the authorization header of the authenticated requests
+func (f *Fetcher) authorization() string {
+	f.tokensMu.RLock()
+	defer f.tokensMu.RUnlock()
+	return "Bearer " + f.accessToken
+}
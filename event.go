@@ -0,0 +1,40 @@
+package orderbookfetcher
+
+import "time"
+
+type EventType string
+
+const (
+	// an orderbook has been written to disk
+	EventSnapshotCommitted EventType = "snapshot.committed"
+	// fetching the orders or the expiry of a location failed
+	EventFetchFailed EventType = "fetch.failed"
+	// a location has been skipped because of the interval
+	EventLocationSkipped EventType = "location.skipped"
+	// a location is no longer being fetched
+	EventLocationRemoved EventType = "location.removed"
+	// we couldn't get a new access token
+	EventTokenRefreshFailed EventType = "token.refresh_failed"
+)
+
+// something that happened inside the fetcher
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// location the event is about, zero for token refreshes
+	LocationID   uint64 `json:"locationId,omitempty"`
+	LocationName string `json:"locationName,omitempty"`
+	// the orderbook that has been written, only set for committed snapshots
+	Orderbook *OrderbookInfo `json:"orderbook,omitempty"`
+	// path of the orderbook file, only set for committed snapshots
+	FileName string `json:"fileName,omitempty"`
+	// what went wrong, only set for failures
+	Error string `json:"error,omitempty"`
+	// expiry of the last orderbook written for the location, only set for failures
+	LastSnapshot *time.Time `json:"lastSnapshot,omitempty"`
+}
+
+// gets called by the fetcher for every event, must not block
+type EventHandler interface {
+	HandleEvent(event *Event)
+}
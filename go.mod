@@ -1,3 +1,8 @@
 module github.com/SustainedCruelty/eve-orderbook-fetcher
 
 go 1.19
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// records what has been sent, for the access log
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	// name of the api key, filled in by authenticate
+	user string
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// the event stream needs to flush
+func (w *accessLogWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// write a line per request in the common log format, followed by the duration
+func (s *Server) logRequests(out io.Writer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		entry := &accessLogWriter{ResponseWriter: w, user: "-"}
+		next.ServeHTTP(entry, r)
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil || host == "" {
+			// unix sockets don't have a remote address
+			host = "-"
+		}
+		if entry.status == 0 {
+			entry.status = http.StatusOK
+		}
+		fmt.Fprintf(out, "%s - %s [%s] %q %d %d %s\n",
+			host, entry.user, started.Format("02/Jan/2006:15:04:05 -0700"),
+			r.Method+" "+r.URL.RequestURI()+" "+r.Proto,
+			entry.status, entry.bytes, time.Since(started).Round(time.Millisecond),
+		)
+	})
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+	"github.com/SustainedCruelty/eve-orderbook-fetcher/esi"
+)
+
+func (s *Server) registerAdminRoutes(r *http.ServeMux) {
+	r.HandleFunc("/api/v1/admin/locations", s.handleAdminLocations)
+	r.HandleFunc("/api/v1/admin/locations/", s.handleAdminLocation)
+}
+
+// start fetching a location
+// POST /api/v1/admin/locations {"location": 10000002, "citadel": false}
+func (s *Server) handleAdminLocations(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var body struct {
+		Location uint64 `json:"location"`
+		Citadel  bool   `json:"citadel"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Location == 0 {
+		writeError(w, http.StatusBadRequest, "expected a location")
+		return
+	}
+	if err := s.ESIFetcher.AddLocation(orderbookfetcher.LocationConfig{ID: body.Location}, body.Citadel); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	for _, status := range s.ESIFetcher.Status().Locations {
+		if status.LocationID == body.Location {
+			writeJSON(w, http.StatusCreated, status)
+			return
+		}
+	}
+	// removed again in the meantime
+	w.WriteHeader(http.StatusCreated)
+}
+
+// stop fetching a location or fetch it right away
+// DELETE /api/v1/admin/locations/{id}
+// POST /api/v1/admin/locations/{id}/fetch
+func (s *Server) handleAdminLocation(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/locations/"), "/"), "/")
+	location, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid location")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if err := s.ESIFetcher.RemoveLocation(location); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "fetch" && r.Method == http.MethodPost:
+		if err := s.ESIFetcher.FetchNow(location); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	case len(parts) <= 2:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// respond with the status matching the error of the fetcher
+func writeAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, esi.ErrLocationExists), errors.Is(err, esi.ErrFetching):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, esi.ErrUnknownLocation):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, esi.ErrNoRefreshToken):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		// most likely esi doesn't know the location
+		writeError(w, http.StatusBadGateway, err.Error())
+	}
+}
@@ -0,0 +1,257 @@
+package http
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+const (
+	// page size if none has been requested
+	defaultLimit = 100
+	// largest page size we hand out
+	maxLimit = 1000
+)
+
+// an orderbook file and its stats
+type snapshotResponse struct {
+	File string `json:"file"`
+	// where the csv can be downloaded
+	URL string `json:"url"`
+	*orderbookfetcher.OrderbookInfo
+}
+
+// a location, how many snapshots it has and the latest one
+type locationResponse struct {
+	*orderbookfetcher.LocationStatus
+	Snapshots int               `json:"snapshots"`
+	Latest    *snapshotResponse `json:"latest,omitempty"`
+}
+
+// a page of snapshots
+type snapshotsResponse struct {
+	// how many snapshots match the filters
+	Total     int                 `json:"total"`
+	Limit     int                 `json:"limit"`
+	Offset    int                 `json:"offset"`
+	Snapshots []*snapshotResponse `json:"snapshots"`
+}
+
+func (s *Server) registerAPIRoutes(r *http.ServeMux) {
+	r.HandleFunc("/api/v1/status", s.handleStatus)
+	r.HandleFunc("/api/v1/locations", s.handleLocations)
+	r.HandleFunc("/api/v1/locations/", s.handleLocation)
+	r.HandleFunc("/api/v1/snapshots/", s.handleSnapshot)
+	// don't let unknown api routes fall through to the template
+	r.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not found")
+	})
+}
+
+// what the fetcher is doing
+// GET /api/v1/status
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	// only show the locations the request may read
+	status := s.ESIFetcher.Status()
+	locations := status.Locations[:0]
+	for _, location := range status.Locations {
+		if s.canRead(r, location.LocationID) {
+			locations = append(locations, location)
+		}
+	}
+	status.Locations = locations
+	// whose token we use is only for those that may read everything
+	if !principalFromContext(r.Context()).readAll {
+		status.Character = nil
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// every location that is being fetched
+// GET /api/v1/locations
+func (s *Server) handleLocations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	snapshots := s.snapshotsByLocation()
+	locations := make([]*locationResponse, 0)
+	for _, status := range s.ESIFetcher.Status().Locations {
+		if !s.canRead(r, status.LocationID) {
+			continue
+		}
+		location := &locationResponse{
+			LocationStatus: status,
+			Snapshots:      len(snapshots[status.LocationID]),
+		}
+		if len(snapshots[status.LocationID]) > 0 {
+			location.Latest = snapshots[status.LocationID][0]
+		}
+		locations = append(locations, location)
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].LocationID < locations[j].LocationID })
+	writeJSON(w, http.StatusOK, locations)
+}
+
+// routes below a location
+// GET /api/v1/locations/{id}/snapshots?from=...&to=...&limit=100&offset=0
+// GET /api/v1/locations/{id}/latest
+func (s *Server) handleLocation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/locations/"), "/"), "/")
+	location, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid location")
+		return
+	}
+	if _, ok := s.ESIFetcher.LocationNames()[location]; !ok {
+		writeError(w, http.StatusNotFound, "unknown location")
+		return
+	}
+	if !s.requireLocation(w, r, location) {
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "snapshots":
+		s.handleLocationSnapshots(w, r, location)
+	case len(parts) == 2 && parts[1] == "latest":
+		s.handleLatestSnapshot(w, r, location)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// a page of the snapshots of a location, newest first
+func (s *Server) handleLocationSnapshots(w http.ResponseWriter, r *http.Request, location uint64) {
+	query := r.URL.Query()
+	from, err := parseTime(query.Get("from"), time.Time{})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from")
+		return
+	}
+	to, err := parseTime(query.Get("to"), time.Time{})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to")
+		return
+	}
+	limit, offset, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	var matching []*snapshotResponse
+	for _, snapshot := range s.snapshotsByLocation()[location] {
+		if (!from.IsZero() && snapshot.Date.Before(from)) || (!to.IsZero() && snapshot.Date.After(to)) {
+			continue
+		}
+		matching = append(matching, snapshot)
+	}
+
+	page := &snapshotsResponse{
+		Total:     len(matching),
+		Limit:     limit,
+		Offset:    offset,
+		Snapshots: []*snapshotResponse{},
+	}
+	if offset < len(matching) {
+		end := offset + limit
+		if end > len(matching) {
+			end = len(matching)
+		}
+		page.Snapshots = matching[offset:end]
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// the stats of a single snapshot
+// GET /api/v1/snapshots/{file}
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/snapshots/"), "/"), "/")
+	file := parts[0]
+	if len(parts) == 2 && parts[1] == "orders" {
+		s.handleSnapshotOrders(w, r, file)
+		return
+	} else if len(parts) > 1 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	snapshot, ok := s.findSnapshot(file)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown snapshot")
+		return
+	}
+	if !s.requireLocation(w, r, snapshot.LocationID) {
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// look up a snapshot by its file name
+func (s *Server) findSnapshot(file string) (*snapshotResponse, bool) {
+	for fileName, info := range s.ESIFetcher.Orderbooks() {
+		if filepath.Base(fileName) == file {
+			return newSnapshotResponse(fileName, info), true
+		}
+	}
+	return nil, false
+}
+
+// the snapshots of every location, newest first
+func (s *Server) snapshotsByLocation() map[uint64][]*snapshotResponse {
+	snapshots := make(map[uint64][]*snapshotResponse)
+	for fileName, info := range s.ESIFetcher.Orderbooks() {
+		snapshots[info.LocationID] = append(snapshots[info.LocationID], newSnapshotResponse(fileName, info))
+	}
+	for _, list := range snapshots {
+		sort.Slice(list, func(i, j int) bool { return list[i].Date.After(list[j].Date) })
+	}
+	return snapshots
+}
+
+func newSnapshotResponse(fileName string, info *orderbookfetcher.OrderbookInfo) *snapshotResponse {
+	file := filepath.Base(fileName)
+	return &snapshotResponse{
+		File:          file,
+		URL:           path.Join("/orderbooks", file),
+		OrderbookInfo: info,
+	}
+}
+
+// read limit and offset from the query, responds with an error if they are invalid
+func parsePage(w http.ResponseWriter, r *http.Request) (limit int, offset int, ok bool) {
+	query := r.URL.Query()
+	limit, offset = defaultLimit, 0
+	var err error
+	if query.Has("limit") {
+		if limit, err = strconv.Atoi(query.Get("limit")); err != nil || limit < 1 || limit > maxLimit {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return 0, 0, false
+		}
+	}
+	if query.Has("offset") {
+		if offset, err = strconv.Atoi(query.Get("offset")); err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, "invalid offset")
+			return 0, 0, false
+		}
+	}
+	return limit, offset, true
+}
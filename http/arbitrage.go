@@ -0,0 +1,31 @@
+package http
+
+import (
+	"net/http"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+func (s *Server) registerArbitrageRoutes(r *http.ServeMux) {
+	r.HandleFunc("/api/v1/arbitrage", s.handleArbitrage)
+}
+
+// return the latest arbitrage report
+// GET /api/v1/arbitrage
+func (s *Server) handleArbitrage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	// only show opportunities between locations the request may read,
+	// filter a copy as the report is shared
+	shared := s.ArbitrageService.ArbitrageReport()
+	report := *shared
+	report.Opportunities = make([]*orderbookfetcher.ArbitrageOpportunity, 0, len(shared.Opportunities))
+	for _, opportunity := range shared.Opportunities {
+		if s.canRead(r, opportunity.From) && s.canRead(r, opportunity.To) {
+			report.Opportunities = append(report.Opportunities, opportunity)
+		}
+	}
+	writeJSON(w, http.StatusOK, report)
+}
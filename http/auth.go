@@ -0,0 +1,162 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// key of the principal in the request context
+type principalContextKey struct{}
+
+// who is making the request and what they may read
+type principal struct {
+	// name of the api key
+	name  string
+	admin bool
+	// every location and the global routes
+	readAll bool
+	// every region/citadel
+	readPublic  bool
+	readCitadel bool
+	// single locations
+	locations map[uint64]struct{}
+}
+
+// used when authentication is disabled, the admin routes need a key
+var anonymous = &principal{name: "-", readAll: true}
+
+// turn the roles of a key into a principal
+func newPrincipal(key orderbookfetcher.APIKey) (*principal, error) {
+	p := &principal{name: key.Name, locations: make(map[uint64]struct{})}
+	for _, role := range key.Roles {
+		switch role {
+		case orderbookfetcher.RoleAdmin:
+			p.admin, p.readAll = true, true
+		case orderbookfetcher.RoleRead:
+			p.readAll = true
+		case orderbookfetcher.RoleReadPublic:
+			p.readPublic = true
+		case orderbookfetcher.RoleReadCitadel:
+			p.readCitadel = true
+		default:
+			location, err := strconv.ParseUint(strings.TrimPrefix(role, "read:"), 10, 64)
+			if !strings.HasPrefix(role, "read:") || err != nil {
+				return nil, fmt.Errorf("api key %s: unknown role %q", key.Name, role)
+			}
+			p.locations[location] = struct{}{}
+		}
+	}
+	return p, nil
+}
+
+// look up the principals by the hash of their key
+func newPrincipals(keys []orderbookfetcher.APIKey) (map[string]*principal, error) {
+	principals := make(map[string]*principal, len(keys))
+	for _, key := range keys {
+		if len(key.Hash) != 64 {
+			return nil, fmt.Errorf("api key %s: hash has to be a hex encoded sha256", key.Name)
+		}
+		p, err := newPrincipal(key)
+		if err != nil {
+			return nil, err
+		}
+		principals[strings.ToLower(key.Hash)] = p
+	}
+	return principals, nil
+}
+
+// require a valid api key on every route but the health checks
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := anonymous
+		if len(s.principals) > 0 && !isPublicRoute(r.URL.Path) {
+			var ok bool
+			if p, ok = s.principals[orderbookfetcher.HashAPIKey(requestKey(r))]; !ok {
+				// lets browsers ask for the key, it's accepted as the password
+				w.Header().Set("WWW-Authenticate", `Basic realm="orderbook-fetcher"`)
+				writeError(w, http.StatusUnauthorized, "missing or invalid api key")
+				return
+			}
+		}
+		if entry, ok := w.(*accessLogWriter); ok {
+			entry.user = p.name
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalContextKey{}, p)))
+	})
+}
+
+// routes that can be reached without a key
+func isPublicRoute(path string) bool {
+	return path == "/healthz" || path == "/readyz" || path == "/favicon.ico"
+}
+
+// the key from the Authorization (bearer or basic) or X-API-Key header
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// who made the request
+func principalFromContext(ctx context.Context) *principal {
+	if p, ok := ctx.Value(principalContextKey{}).(*principal); ok {
+		return p
+	}
+	return anonymous
+}
+
+// may the request read the location?
+// locations we aren't fetching (files from earlier runs) need the read role
+func (s *Server) canRead(r *http.Request, location uint64) bool {
+	p := principalFromContext(r.Context())
+	if p.readAll {
+		return true
+	}
+	if _, ok := p.locations[location]; ok {
+		return true
+	}
+	isCitadel, known := s.ESIFetcher.LocationKind(location)
+	if !known {
+		return false
+	}
+	return (isCitadel && p.readCitadel) || (!isCitadel && p.readPublic)
+}
+
+// respond with 403 unless the request may read the location
+func (s *Server) requireLocation(w http.ResponseWriter, r *http.Request, location uint64) bool {
+	if !s.canRead(r, location) {
+		writeError(w, http.StatusForbidden, "not allowed to read this location")
+		return false
+	}
+	return true
+}
+
+// respond with 403 unless the request may read every location
+func requireReadAll(w http.ResponseWriter, r *http.Request) bool {
+	if !principalFromContext(r.Context()).readAll {
+		writeError(w, http.StatusForbidden, "not allowed")
+		return false
+	}
+	return true
+}
+
+// respond with 403 unless the request has the admin role
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !principalFromContext(r.Context()).admin {
+		writeError(w, http.StatusForbidden, "not allowed")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+func (s *Server) registerCandleRoutes(r *http.ServeMux) {
+	r.HandleFunc("/api/v1/candles", s.handleCandles)
+}
+
+// return the candles of a type at a location
+// GET /api/v1/candles?location=10000002&type=34&bucket=1h&from=...&to=...
+func (s *Server) handleCandles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+
+	location, err := strconv.ParseUint(query.Get("location"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid location")
+		return
+	}
+	if !s.requireLocation(w, r, location) {
+		return
+	}
+	typeID, err := strconv.ParseInt(query.Get("type"), 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid type")
+		return
+	}
+	bucket := orderbookfetcher.Duration(time.Hour)
+	if query.Has("bucket") {
+		if bucket, err = orderbookfetcher.ParseDuration(query.Get("bucket")); err != nil || bucket <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid bucket")
+			return
+		}
+	}
+	// default to the last day
+	to, err := parseTime(query.Get("to"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to")
+		return
+	}
+	from, err := parseTime(query.Get("from"), to.Add(-24*time.Hour))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from")
+		return
+	}
+
+	candles, err := s.CandleService.FindCandles(location, int32(typeID), bucket, from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Something went wrong")
+		log.Printf("failed to find candles: %s", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, candles)
+}
@@ -0,0 +1,185 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// assure interface compliance
+var _ orderbookfetcher.EventHandler = (*EventBroker)(nil)
+
+const (
+	// how many events a slow client may fall behind before we drop events for it
+	subscriberBuffer = 16
+	// keeps proxies from closing idle streams
+	heartbeatInterval = 30 * time.Second
+)
+
+// fans the committed snapshots out to the connected event streams
+type EventBroker struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	// closed once the server shuts down, ends all streams
+	done chan struct{}
+}
+
+// a single connected client
+type subscriber struct {
+	events chan *snapshotResponse
+	// only send snapshots of these locations, all if empty
+	locations map[uint64]struct{}
+	// may the client read the location?
+	allowed func(uint64) bool
+}
+
+// construct a new broker without any subscribers
+func NewEventBroker() *EventBroker {
+	return &EventBroker{
+		subscribers: make(map[*subscriber]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// pass committed snapshots on to the subscribers, never blocks the fetcher
+func (b *EventBroker) HandleEvent(event *orderbookfetcher.Event) {
+	if event.Type != orderbookfetcher.EventSnapshotCommitted || event.Orderbook == nil {
+		return
+	}
+	snapshot := newSnapshotResponse(event.FileName, event.Orderbook)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		if !sub.wants(event.LocationID) {
+			continue
+		}
+		select {
+		case sub.events <- snapshot:
+		default:
+			// the client isn't keeping up, it can catch up through the api
+		}
+	}
+}
+
+// end all streams
+func (b *EventBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.done:
+	default:
+		close(b.done)
+	}
+}
+
+func (b *EventBroker) subscribe(locations map[uint64]struct{}, allowed func(uint64) bool) *subscriber {
+	sub := &subscriber{
+		events:    make(chan *snapshotResponse, subscriberBuffer),
+		locations: locations,
+		allowed:   allowed,
+	}
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+func (b *EventBroker) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	delete(b.subscribers, sub)
+	b.mu.Unlock()
+}
+
+// is the subscriber interested in the location?
+func (sub *subscriber) wants(location uint64) bool {
+	if !sub.allowed(location) {
+		return false
+	}
+	if len(sub.locations) == 0 {
+		return true
+	}
+	_, ok := sub.locations[location]
+	return ok
+}
+
+func (s *Server) registerEventRoutes(r *http.ServeMux) {
+	r.HandleFunc("/api/v1/events", s.handleEvents)
+}
+
+// stream of the committed snapshots as server-sent events
+// GET /api/v1/events?location=60003760,10000002
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	locations := make(map[uint64]struct{})
+	if query := r.URL.Query().Get("location"); query != "" {
+		for _, l := range strings.Split(query, ",") {
+			location, err := strconv.ParseUint(strings.TrimSpace(l), 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid location")
+				return
+			}
+			locations[location] = struct{}{}
+		}
+	}
+
+	// the stream is meant to stay open, don't let the write timeout cut it off
+	if conn, ok := r.Context().Value(connContextKey{}).(net.Conn); ok {
+		conn.SetWriteDeadline(time.Time{})
+	}
+
+	sub := s.Events.subscribe(locations, func(location uint64) bool { return s.canRead(r, location) })
+	defer s.Events.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// tell nginx not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// have the client reconnect after 5 seconds if the stream breaks
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case snapshot := <-sub.events:
+			data, err := json.Marshal(snapshot)
+			if err != nil {
+				log.Printf("failed to encode event: %s", err)
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "id: %d-%d\nevent: snapshot\ndata: %s\n\n", snapshot.LocationID, snapshot.Date.Unix(), data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.Events.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package http
+
+import "net/http"
+
+func (s *Server) registerHealthRoutes(r *http.ServeMux) {
+	r.HandleFunc("/healthz", s.handleHealth)
+	r.HandleFunc("/readyz", s.handleReady)
+}
+
+// the process is up and serving requests
+// GET /healthz
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// the fetcher is still running and its orderbooks are fresh,
+// responds with 503 and the problems if it isn't
+// GET /readyz
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	readiness := s.ESIFetcher.Readiness()
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, readiness)
+}
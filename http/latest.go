@@ -0,0 +1,174 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// how long esi caches the market orders,
+// the data of a snapshot was generated this long before it expires
+const marketCacheDuration = 5 * time.Minute
+
+// serve the orderbook files, and the latest one of a location at /orderbooks/{id}/latest.csv
+func (s *Server) handleOrderbookFiles() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/orderbooks/"), "/"), "/")
+		if len(parts) == 2 && parts[1] == "latest.csv" {
+			location, err := strconv.ParseUint(parts[0], 10, 64)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			if !s.canRead(r, location) {
+				http.Error(w, "not allowed to read this location", http.StatusForbidden)
+				return
+			}
+			s.handleLatestOrderbookFile(w, r, location)
+			return
+		}
+		// orderbook files may be read by anyone allowed to read their location,
+		// everything else (the directory listing etc.) requires the read role
+		file := path.Base(r.URL.Path)
+		location, _, err := orderbookfetcher.ParseOrderbookFileName(file)
+		if (err != nil && !principalFromContext(r.Context()).readAll) || (err == nil && !s.canRead(r, location)) {
+			http.Error(w, "not allowed to read this file", http.StatusForbidden)
+			return
+		}
+		// orderbooks might be in the directory of their location
+		if err == nil {
+			http.ServeFile(w, r, s.orderbookPath(file))
+			return
+		}
+		http.StripPrefix("/orderbooks", http.FileServer(http.Dir(s.OrderbookDirectory))).ServeHTTP(w, r)
+	}
+}
+
+// where an orderbook file is on disk, locations can have their own directory.
+// files the fetcher doesn't know about are looked for in the directory of their location
+func (s *Server) orderbookPath(file string) string {
+	for fileName := range s.ESIFetcher.Orderbooks() {
+		if filepath.Base(fileName) == file {
+			return fileName
+		}
+	}
+	if location, _, err := orderbookfetcher.ParseOrderbookFileName(file); err == nil {
+		return filepath.Join(s.ESIFetcher.OrderbookDirectory(location), file)
+	}
+	return filepath.Join(s.OrderbookDirectory, file)
+}
+
+// the csv of the newest snapshot of a location
+func (s *Server) handleLatestOrderbookFile(w http.ResponseWriter, r *http.Request, location uint64) {
+	fileName, info, ok := s.ESIFetcher.LatestOrderbook(location)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	etag := s.setCacheHeaders(w, info)
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.TrimSuffix(filepath.Base(fileName), ".gz")))
+
+	// gzipped orderbooks are sent as they are if the client can handle it
+	gzipped := strings.HasSuffix(fileName, ".gz")
+	if !gzipped || acceptsGzip(r) {
+		file, err := os.Open(fileName)
+		if err != nil {
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			log.Printf("failed to open the latest orderbook: %s", err)
+			return
+		}
+		defer file.Close()
+		if gzipped {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("Vary", "Accept-Encoding")
+		}
+		// handles If-None-Match, If-Modified-Since and ranges for us
+		http.ServeContent(w, r, "", lastModified(info), file)
+		return
+	}
+
+	// otherwise we decompress it, without ranges
+	w.Header().Set("Vary", "Accept-Encoding")
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	file, err := orderbookfetcher.OpenOrderbook(fileName)
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("failed to open the latest orderbook: %s", err)
+		return
+	}
+	defer file.Close()
+	if _, err = io.Copy(w, file); err != nil {
+		log.Printf("failed to send the latest orderbook: %s", err)
+	}
+}
+
+// does the client take a gzipped response?
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(part, ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+		// "gzip;q=0" means it doesn't
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				return err == nil && q > 0
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// the stats of the newest snapshot of a location
+// GET /api/v1/locations/{id}/latest
+func (s *Server) handleLatestSnapshot(w http.ResponseWriter, r *http.Request, location uint64) {
+	fileName, info, ok := s.ESIFetcher.LatestOrderbook(location)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no snapshot for this location yet")
+		return
+	}
+	etag := s.setCacheHeaders(w, info)
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, newSnapshotResponse(fileName, info))
+}
+
+// set ETag, Last-Modified and Cache-Control from the expiry of the snapshot.
+// caches may keep the response until the location's esi data expires next
+func (s *Server) setCacheHeaders(w http.ResponseWriter, info *orderbookfetcher.OrderbookInfo) string {
+	etag := fmt.Sprintf(`"%d-%d"`, info.LocationID, info.Date.Unix())
+	maxAge := time.Until(info.Date)
+	if next, ok := s.ESIFetcher.NextExpiry(info.LocationID); ok && next.After(info.Date) {
+		maxAge = time.Until(next)
+	}
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified(info).UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+	return etag
+}
+
+// when esi generated the data of the snapshot
+func lastModified(info *orderbookfetcher.OrderbookInfo) time.Time {
+	return info.Date.Add(-marketCacheDuration)
+}
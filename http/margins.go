@@ -0,0 +1,64 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+func (s *Server) registerMarginRoutes(r *http.ServeMux) {
+	r.HandleFunc("/api/v1/margins", s.handleMargins)
+}
+
+// return the station trading margins of a location
+// GET /api/v1/margins?location=10000002&station=60003760&limit=100
+func (s *Server) handleMargins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+
+	location, err := strconv.ParseUint(query.Get("location"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid location")
+		return
+	}
+	if !s.requireLocation(w, r, location) {
+		return
+	}
+	var station int64
+	if query.Has("station") {
+		if station, err = strconv.ParseInt(query.Get("station"), 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid station")
+			return
+		}
+	}
+	limit := 0
+	if query.Has("limit") {
+		if limit, err = strconv.Atoi(query.Get("limit")); err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	report, ok := s.MarginService.MarginReport(location)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no report for this location yet")
+		return
+	}
+
+	// filter a copy, the report is shared
+	filtered := *report
+	filtered.Trades = make([]*orderbookfetcher.StationTrade, 0, len(report.Trades))
+	for _, trade := range report.Trades {
+		if limit > 0 && len(filtered.Trades) == limit {
+			break
+		}
+		if station == 0 || trade.StationID == station {
+			filtered.Trades = append(filtered.Trades, trade)
+		}
+	}
+	writeJSON(w, http.StatusOK, filtered)
+}
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+func (s *Server) registerMetricsRoutes(r *http.ServeMux) {
+	r.HandleFunc("/metrics", s.handleMetrics)
+}
+
+// the fetcher's counters in the prometheus text format
+// GET /metrics
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireReadAll(w, r) {
+		return
+	}
+	metrics := s.ESIFetcher.Metrics()
+	now := time.Now()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := &metricWriter{w: bufio.NewWriter(w)}
+	defer m.w.Flush()
+
+	m.header("orderbook_esi_responses_total", "counter", "Responses from esi by status code.")
+	codes := make([]int, 0, len(metrics.Responses))
+	for code := range metrics.Responses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		m.sample("orderbook_esi_responses_total", fmt.Sprintf(`code="%d"`, code), float64(metrics.Responses[code]))
+	}
+	m.header("orderbook_esi_request_errors_total", "counter", "Requests to esi that didn't get a response.")
+	m.sample("orderbook_esi_request_errors_total", "", float64(metrics.RequestErrors))
+	if metrics.ErrorLimitRemain >= 0 {
+		m.header("orderbook_esi_error_limit_remaining", "gauge", "The last value of the X-Esi-Error-Limit-Remain header.")
+		m.sample("orderbook_esi_error_limit_remaining", "", float64(metrics.ErrorLimitRemain))
+	}
+	m.header("orderbook_token_refreshes_total", "counter", "Access token refreshes by result.")
+	m.sample("orderbook_token_refreshes_total", `result="success"`, float64(metrics.TokenRefreshes))
+	m.sample("orderbook_token_refreshes_total", `result="failure"`, float64(metrics.TokenRefreshFailures))
+
+	// one family per location metric, every location is a sample
+	locationMetrics := []struct {
+		name, kind, help string
+		value            func(l *orderbookfetcher.LocationMetrics) (float64, bool)
+	}{
+		{"orderbook_fetches_total", "counter", "Orderbooks that have been written.",
+			func(l *orderbookfetcher.LocationMetrics) (float64, bool) { return float64(l.Fetches), true }},
+		{"orderbook_fetch_failures_total", "counter", "Fetches that failed.",
+			func(l *orderbookfetcher.LocationMetrics) (float64, bool) { return float64(l.Failures), true }},
+		{"orderbook_fetch_duration_seconds_total", "counter", "Time spent fetching orderbooks.",
+			func(l *orderbookfetcher.LocationMetrics) (float64, bool) { return l.FetchDuration.Seconds(), true }},
+		{"orderbook_last_fetch_duration_seconds", "gauge", "How long the last fetch took.",
+			func(l *orderbookfetcher.LocationMetrics) (float64, bool) {
+				return l.LastFetchDuration.Seconds(), l.Fetches > 0
+			}},
+		{"orderbook_pages_total", "counter", "Order pages that have been fetched.",
+			func(l *orderbookfetcher.LocationMetrics) (float64, bool) { return float64(l.Pages), true }},
+		{"orderbook_last_pages", "gauge", "Order pages of the last orderbook.",
+			func(l *orderbookfetcher.LocationMetrics) (float64, bool) { return float64(l.LastPages), l.Fetches > 0 }},
+		{"orderbook_retries_total", "counter", "Order page requests that had to be repeated.",
+			func(l *orderbookfetcher.LocationMetrics) (float64, bool) { return float64(l.Retries), true }},
+		{"orderbook_skipped_total", "counter", "Fetches skipped because of the interval.",
+			func(l *orderbookfetcher.LocationMetrics) (float64, bool) { return float64(l.Skipped), true }},
+		{"orderbook_next_expiry_seconds", "gauge", "Time until the esi data of the location expires.",
+			func(l *orderbookfetcher.LocationMetrics) (float64, bool) {
+				return l.NextExpiry.Sub(now).Seconds(), true
+			}},
+		{"orderbook_disk_bytes", "gauge", "Size of the orderbooks of the location on disk.",
+			func(l *orderbookfetcher.LocationMetrics) (float64, bool) { return float64(l.DiskBytes), true }},
+		{"orderbook_snapshot_timestamp_seconds", "gauge", "Expiry of the last orderbook as a unix timestamp.",
+			func(l *orderbookfetcher.LocationMetrics) (float64, bool) {
+				if l.LastOrderbook == nil {
+					return 0, false
+				}
+				return float64(l.LastOrderbook.Date.Unix()), true
+			}},
+		{"orderbook_snapshot_age_seconds", "gauge", "Time since the last orderbook expired.",
+			func(l *orderbookfetcher.LocationMetrics) (float64, bool) {
+				if l.LastOrderbook == nil {
+					return 0, false
+				}
+				return now.Sub(l.LastOrderbook.Date).Seconds(), true
+			}},
+	}
+	for _, metric := range locationMetrics {
+		m.header(metric.name, metric.kind, metric.help)
+		for _, location := range metrics.Locations {
+			if value, ok := metric.value(location); ok {
+				m.sample(metric.name, locationLabels(location), value)
+			}
+		}
+	}
+
+	m.header("orderbook_snapshot_orders", "gauge", "Orders in the last orderbook by side.")
+	for _, location := range metrics.Locations {
+		if location.LastOrderbook == nil {
+			continue
+		}
+		m.sample("orderbook_snapshot_orders", locationLabels(location)+`,side="buy"`, float64(location.LastOrderbook.BuyOrderCount))
+		m.sample("orderbook_snapshot_orders", locationLabels(location)+`,side="sell"`, float64(location.LastOrderbook.SellOrderCount))
+	}
+}
+
+// writes metric families in the prometheus text format
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+func (m *metricWriter) header(name, kind, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (m *metricWriter) sample(name, labels string, value float64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	fmt.Fprintf(m.w, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// the labels identifying a location
+func locationLabels(l *orderbookfetcher.LocationMetrics) string {
+	return fmt.Sprintf(`location="%d",name="%s",citadel="%t"`, l.LocationID, labelEscaper.Replace(l.LocationName), l.IsCitadel)
+}
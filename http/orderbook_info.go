@@ -4,6 +4,7 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"path/filepath"
 
 	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
 )
@@ -15,7 +16,7 @@ func (s *Server) registerOrderbookRoutes(r *http.ServeMux) {
 // serve the template
 func (s *Server) handleOrderbookInfo(w http.ResponseWriter, r *http.Request) {
 	// load the file
-	tmpl, err := template.ParseFiles("http/assets/index.html")
+	tmpl, err := template.New("index.html").Funcs(template.FuncMap{"base": filepath.Base}).ParseFiles("http/assets/index.html")
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("failed to parse the template: %s", err)
@@ -27,8 +28,19 @@ func (s *Server) handleOrderbookInfo(w http.ResponseWriter, r *http.Request) {
 		Locations  map[uint64]string
 		Orderbooks map[string]*orderbookfetcher.OrderbookInfo
 	}{
-		Locations:  s.ESIFetcher.Locations,
-		Orderbooks: s.ESIFetcher.WrittenOrderbooks,
+		Locations:  make(map[uint64]string),
+		Orderbooks: make(map[string]*orderbookfetcher.OrderbookInfo),
+	}
+	// only show the locations the request may read
+	for location, name := range s.ESIFetcher.LocationNames() {
+		if s.canRead(r, location) {
+			data.Locations[location] = name
+		}
+	}
+	for fileName, info := range s.ESIFetcher.Orderbooks() {
+		if s.canRead(r, info.LocationID) {
+			data.Orderbooks[fileName] = info
+		}
 	}
 
 	// serve the template
@@ -0,0 +1,216 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// writes the matching orders in one of the supported formats
+type orderEncoder interface {
+	Begin() error
+	Encode(order *orderbookfetcher.MarketOrder) error
+	End() error
+}
+
+// the orders of a snapshot, filtered on the server
+// GET /api/v1/snapshots/{file}/orders?type=34,35&side=sell&station=60003760&system=30000142&minPrice=1&maxPrice=10&minVolume=100
+func (s *Server) handleSnapshotOrders(w http.ResponseWriter, r *http.Request, file string) {
+	// validates the name, so we can't be tricked into opening anything else
+	location, _, err := orderbookfetcher.ParseOrderbookFileName(file)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "unknown snapshot")
+		return
+	}
+	if !s.requireLocation(w, r, location) {
+		return
+	}
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f, err := orderbookfetcher.OpenOrderbook(s.orderbookPath(file))
+	if os.IsNotExist(err) {
+		writeError(w, http.StatusNotFound, "unknown snapshot")
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "Something went wrong")
+		log.Printf("failed to open snapshot: %s", err)
+		return
+	}
+	defer f.Close()
+
+	contentType, encoder := negotiateOrderEncoder(w, r.Header.Get("Accept"))
+	w.Header().Set("Content-Type", contentType)
+	if err = encoder.Begin(); err != nil {
+		return
+	}
+	reader := orderbookfetcher.NewOrderReader(f)
+	for {
+		order, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			// the status has already been sent, all we can do is stop
+			log.Printf("failed to read snapshot %s: %s", file, err)
+			return
+		}
+		if !filter.Match(order) {
+			continue
+		}
+		if err = encoder.Encode(order); err != nil {
+			return
+		}
+	}
+	encoder.End()
+}
+
+// build the filter from the query parameters
+func parseOrderFilter(r *http.Request) (*orderbookfetcher.OrderFilter, error) {
+	query := r.URL.Query()
+	filter := &orderbookfetcher.OrderFilter{}
+
+	if query.Has("type") {
+		filter.TypeIDs = make(map[int32]struct{})
+		for _, t := range strings.Split(query.Get("type"), ",") {
+			typeID, err := strconv.ParseInt(strings.TrimSpace(t), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid type")
+			}
+			filter.TypeIDs[int32(typeID)] = struct{}{}
+		}
+	}
+	switch query.Get("side") {
+	case "":
+	case "buy":
+		isBuy := true
+		filter.IsBuyOrder = &isBuy
+	case "sell":
+		isBuy := false
+		filter.IsBuyOrder = &isBuy
+	default:
+		return nil, fmt.Errorf("invalid side, expected buy or sell")
+	}
+
+	var err error
+	if query.Has("station") {
+		if filter.StationID, err = strconv.ParseInt(query.Get("station"), 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid station")
+		}
+	}
+	if query.Has("system") {
+		system, err := strconv.ParseInt(query.Get("system"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid system")
+		}
+		filter.SystemID = int32(system)
+	}
+	if query.Has("minPrice") {
+		if filter.MinPrice, err = strconv.ParseFloat(query.Get("minPrice"), 64); err != nil {
+			return nil, fmt.Errorf("invalid minPrice")
+		}
+	}
+	if query.Has("maxPrice") {
+		if filter.MaxPrice, err = strconv.ParseFloat(query.Get("maxPrice"), 64); err != nil {
+			return nil, fmt.Errorf("invalid maxPrice")
+		}
+	}
+	if query.Has("minVolume") {
+		volume, err := strconv.ParseInt(query.Get("minVolume"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid minVolume")
+		}
+		filter.MinVolume = int32(volume)
+	}
+	return filter, nil
+}
+
+// pick the encoder for the first supported media type in the accept header, json by default
+func negotiateOrderEncoder(w io.Writer, accept string) (string, orderEncoder) {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/csv":
+			return "text/csv", &csvOrderEncoder{w: w}
+		case "application/x-ndjson", "application/ndjson":
+			return "application/x-ndjson", &ndjsonOrderEncoder{encoder: json.NewEncoder(w)}
+		case "application/json":
+			return "application/json", &jsonOrderEncoder{w: w}
+		}
+	}
+	return "application/json", &jsonOrderEncoder{w: w}
+}
+
+// a single json array
+type jsonOrderEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonOrderEncoder) Begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonOrderEncoder) Encode(order *orderbookfetcher.MarketOrder) error {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err = io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonOrderEncoder) End() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
+
+// one json object per line
+type ndjsonOrderEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonOrderEncoder) Begin() error { return nil }
+
+func (e *ndjsonOrderEncoder) Encode(order *orderbookfetcher.MarketOrder) error {
+	return e.encoder.Encode(order)
+}
+
+func (e *ndjsonOrderEncoder) End() error { return nil }
+
+// the same format as the orderbook files
+type csvOrderEncoder struct {
+	w io.Writer
+}
+
+func (e *csvOrderEncoder) Begin() error {
+	_, err := fmt.Fprintln(e.w, orderbookfetcher.CSVHeader)
+	return err
+}
+
+func (e *csvOrderEncoder) Encode(order *orderbookfetcher.MarketOrder) error {
+	order.WriteAsCSV(e.w)
+	return nil
+}
+
+func (e *csvOrderEncoder) End() error { return nil }
@@ -2,33 +2,91 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
+	"io"
 	"log"
 	"net"
 	"net/http"
-	_ "net/http/pprof"
+	"net/http/pprof"
+	"os"
+	"strings"
 	"time"
 
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
 	"github.com/SustainedCruelty/eve-orderbook-fetcher/esi"
 )
 
+// key of the connection in the request context
+type connContextKey struct{}
+
 type Server struct {
-	ln     net.Listener
+	lns    []net.Listener
 	server *http.Server
 	router *http.ServeMux
 
-	ESIFetcher *esi.Fetcher
+	// serves pprof on a separate listener
+	adminLn     net.Listener
+	adminServer *http.Server
+
+	// where the orderbook files are stored
+	OrderbookDirectory string
+
+	// addresses to listen on, "host:port" or "unix:/path/to/socket"
+	Listen []string
+	// serve https if both are set
+	TLSCertFile string
+	TLSKeyFile  string
+	// limits on reading a request and writing a response, no limit if zero
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// address of the pprof listener, disabled if empty
+	AdminListen string
+
+	// keys that may access the api, authentication is disabled if there are none
+	APIKeys []orderbookfetcher.APIKey
+	// file the access log is appended to, the regular log if empty
+	AccessLogFile string
+	// look up who is making a request by the hash of their key
+	principals map[string]*principal
+	accessLog  *os.File
+
+	ESIFetcher       *esi.Fetcher
+	CandleService    orderbookfetcher.CandleService
+	ArbitrageService orderbookfetcher.ArbitrageService
+	MarginService    orderbookfetcher.MarginService
+
+	// streams the committed snapshots to the clients,
+	// has to be registered as an event handler with the fetcher
+	Events *EventBroker
 }
 
 // Create a new instance of our server
 func NewServer() *Server {
 	s := &Server{
 		server: &http.Server{},
-		router: http.DefaultServeMux,
+		router: http.NewServeMux(),
+
+		OrderbookDirectory: "orderbooks",
+		Listen:             []string{":8080"},
+		Events:             NewEventBroker(),
+	}
+	// lets handlers get at their connection, see handleEvents
+	s.server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, connContextKey{}, c)
 	}
 
 	// register all of the necessary handlers
 	s.registerOrderbookRoutes(s.router)
-	s.router.Handle("/orderbooks/", http.StripPrefix("/orderbooks", http.FileServer(http.Dir("./orderbooks"))))
+	s.registerAPIRoutes(s.router)
+	s.registerEventRoutes(s.router)
+	s.registerAdminRoutes(s.router)
+	s.registerMetricsRoutes(s.router)
+	s.registerHealthRoutes(s.router)
+	s.registerCandleRoutes(s.router)
+	s.registerArbitrageRoutes(s.router)
+	s.registerMarginRoutes(s.router)
+	s.router.Handle("/orderbooks/", s.handleOrderbookFiles())
 	s.router.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "http/assets/favicon.ico")
 	})
@@ -38,11 +96,84 @@ func NewServer() *Server {
 
 // start listening
 func (s *Server) Open() (err error) {
-	if s.ln, err = net.Listen("tcp", ":8080"); err != nil {
+	s.server.ReadHeaderTimeout = 10 * time.Second
+	s.server.ReadTimeout = s.ReadTimeout
+	s.server.WriteTimeout = s.WriteTimeout
+	s.server.IdleTimeout = s.IdleTimeout
+
+	if s.principals, err = newPrincipals(s.APIKeys); err != nil {
 		return err
 	}
-	log.Println("listening on port 8080")
-	go s.server.Serve(s.ln)
+	if len(s.principals) == 0 {
+		log.Println("no api keys configured, authentication is disabled")
+		log.Println("the admin api is disabled until a key with the admin role is configured")
+	}
+	var accessLog io.Writer = log.Writer()
+	if s.AccessLogFile != "" {
+		if s.accessLog, err = os.OpenFile(s.AccessLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			return err
+		}
+		accessLog = s.accessLog
+	}
+	s.server.Handler = s.logRequests(accessLog, s.authenticate(s.router))
+
+	useTLS := s.TLSCertFile != "" && s.TLSKeyFile != ""
+	if useTLS {
+		certs, err := newCertReloader(s.TLSCertFile, s.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		s.server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+
+	for _, addr := range s.Listen {
+		ln, err := listen(addr)
+		if err != nil {
+			s.closeListeners()
+			return err
+		}
+		s.lns = append(s.lns, ln)
+	}
+	for _, ln := range s.lns {
+		if useTLS {
+			log.Printf("listening on %s (https)", ln.Addr())
+			go s.server.ServeTLS(ln, "", "")
+		} else {
+			log.Printf("listening on %s", ln.Addr())
+			go s.server.Serve(ln)
+		}
+	}
+
+	if s.AdminListen != "" {
+		if err = s.openAdmin(); err != nil {
+			s.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// serve pprof on the admin listener, it must not be reachable from the outside
+func (s *Server) openAdmin() (err error) {
+	router := http.NewServeMux()
+	router.HandleFunc("/debug/pprof/", pprof.Index)
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	if s.adminLn, err = listen(s.AdminListen); err != nil {
+		return err
+	}
+	s.adminServer = &http.Server{
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("admin listening on %s", s.adminLn.Addr())
+	go s.adminServer.Serve(s.adminLn)
 	return nil
 }
 
@@ -50,5 +181,38 @@ func (s *Server) Open() (err error) {
 func (s *Server) Close() error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
 	defer cancel()
-	return s.server.Shutdown(ctx)
+	// the event streams would otherwise hold up the shutdown
+	s.Events.Close()
+	if s.adminServer != nil {
+		s.adminServer.Shutdown(ctx)
+	}
+	if len(s.lns) == 0 {
+		return nil
+	}
+	err := s.server.Shutdown(ctx)
+	if s.accessLog != nil {
+		s.accessLog.Close()
+	}
+	return err
+}
+
+// close the listeners that have been opened, in case we fail halfway through
+func (s *Server) closeListeners() {
+	for _, ln := range s.lns {
+		ln.Close()
+	}
+	s.lns = nil
+}
+
+// listen on a tcp address or a unix socket ("unix:/path/to/socket")
+func listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, "unix:") {
+		return net.Listen("tcp", addr)
+	}
+	path := strings.TrimPrefix(addr, "unix:")
+	// a socket left over from an earlier run would make listening fail
+	if stat, err := os.Stat(path); err == nil && stat.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
 }
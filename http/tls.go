@@ -0,0 +1,80 @@
+package http
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// hands out the certificate and loads it again once the files have changed,
+// so renewed certificates are picked up without a restart
+type certReloader struct {
+	mu sync.Mutex
+
+	certFile string
+	keyFile  string
+
+	cert *tls.Certificate
+	// modification times of the files the certificate was loaded from
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// load the certificate for the first time
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// used as tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.changed() {
+		// keep serving the old certificate if the new one is broken,
+		// it might just be halfway written and we'll try again once it changes
+		if err := r.reload(); err != nil {
+			log.Printf("failed to reload the certificate: %s", err)
+		} else {
+			log.Printf("reloaded the certificate")
+		}
+	}
+	return r.cert, nil
+}
+
+// have the files been modified since we loaded them?
+func (r *certReloader) changed() bool {
+	certStat, err := os.Stat(r.certFile)
+	if err != nil {
+		return false
+	}
+	keyStat, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false
+	}
+	return !certStat.ModTime().Equal(r.certMod) || !keyStat.ModTime().Equal(r.keyMod)
+}
+
+func (r *certReloader) reload() error {
+	certStat, err := os.Stat(r.certFile)
+	if err != nil {
+		return err
+	}
+	keyStat, err := os.Stat(r.keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	// only once the pair has been loaded, a half written one is tried again
+	r.cert = &cert
+	r.certMod, r.keyMod = certStat.ModTime(), keyStat.ModTime()
+	return nil
+}
@@ -0,0 +1,68 @@
+package orderbookfetcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// formats the orderbooks can be written in
+const (
+	FormatCSV     = "csv"
+	FormatCSVGzip = "csv.gz"
+)
+
+// a region or citadel and how it's fetched. in the configuration file it's either
+// a plain id, or an object that overrides the global options for this location
+type LocationConfig struct {
+	ID uint64 `json:"id"`
+	// shown instead of the name from esi
+	Name string `json:"name,omitempty"`
+	// fetch every n orderbooks, the global interval if zero
+	Interval uint `json:"interval,omitempty"`
+	// how many orderbooks to keep, the global retention period if nil
+	RetentionPeriod *uint `json:"retentionPeriod,omitempty"`
+	// delete orderbooks older than this, the global max age if zero
+	MaxAge Duration `json:"maxAge,omitempty"`
+	// disk budget of this location, the global location budget if zero
+	MaxBytes ByteSize `json:"maxBytes,omitempty"`
+	// "csv" (default) or "csv.gz"
+	Format string `json:"format,omitempty"`
+	// where the orderbooks are written to, the orderbook directory if empty
+	Directory string `json:"directory,omitempty"`
+	// only write the orders of these types, all of them if empty
+	Types []int32 `json:"types,omitempty"`
+}
+
+// accept a plain id as well as an object
+func (l *LocationConfig) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] != '{' {
+		*l = LocationConfig{}
+		if err := json.Unmarshal(data, &l.ID); err != nil {
+			return fmt.Errorf("a location has to be an id or an object: %w", err)
+		}
+		return nil
+	}
+	// the alias doesn't have the method, so we don't end up in here again
+	type location LocationConfig
+	return json.Unmarshal(data, (*location)(l))
+}
+
+// write a plain id if nothing has been overridden
+func (l LocationConfig) MarshalJSON() ([]byte, error) {
+	if l.Name == "" && l.Interval == 0 && l.RetentionPeriod == nil && l.MaxAge == 0 && l.MaxBytes == 0 && l.Format == "" && l.Directory == "" && len(l.Types) == 0 {
+		return json.Marshal(l.ID)
+	}
+	type location LocationConfig
+	return json.Marshal(location(l))
+}
+
+// the ids of the locations
+func LocationIDs(locations []LocationConfig) []uint64 {
+	ids := make([]uint64, len(locations))
+	for i, location := range locations {
+		ids[i] = location.ID
+	}
+	return ids
+}
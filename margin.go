@@ -0,0 +1,39 @@
+package orderbookfetcher
+
+import "time"
+
+// the spread of a type at a single station
+type StationTrade struct {
+	TypeID    int32 `json:"typeId"`
+	StationID int64 `json:"stationId"`
+	// highest buy and lowest sell order
+	BestBuy  float64 `json:"bestBuy"`
+	BestSell float64 `json:"bestSell"`
+	// what's left of the spread after fees, per unit
+	ProfitPerUnit float64 `json:"profitPerUnit"`
+	// profit / what we pay for a unit
+	Margin float64 `json:"margin"`
+	// how many orders are competing near the top of each side?
+	BuyCompetitors  uint `json:"buyCompetitors"`
+	SellCompetitors uint `json:"sellCompetitors"`
+	// most recent update (issue date) of the competing orders
+	BuyUpdated  time.Time `json:"buyUpdated"`
+	SellUpdated time.Time `json:"sellUpdated"`
+	// average volume traded per day, nil if we haven't watched the market long enough
+	DailyVolume *float64 `json:"dailyVolume,omitempty"`
+}
+
+// station trading opportunities of a location
+type MarginReport struct {
+	LocationID   uint64 `json:"locationId"`
+	LocationName string `json:"locationName"`
+	// expiry of the snapshot the report is based on
+	Date time.Time `json:"date"`
+	// sorted by margin, highest first
+	Trades []*StationTrade `json:"trades"`
+}
+
+// provides the latest margin report of a location
+type MarginService interface {
+	MarginReport(location uint64) (*MarginReport, bool)
+}
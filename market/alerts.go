@@ -0,0 +1,236 @@
+package market
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// assure interface compliance
+var _ orderbookfetcher.SnapshotHandler = (*AlertWatcher)(nil)
+
+// compares every snapshot against the watchlist and sends alerts
+// when our orders get undercut/outbid or the best price of a type moves too much
+type AlertWatcher struct {
+	mu sync.Mutex
+
+	notifier orderbookfetcher.Notifier
+	// watchlist entries by location
+	watchlist map[uint64][]orderbookfetcher.WatchlistEntry
+
+	// best prices of the watched types in the previous snapshot, by location
+	bids map[uint64]map[int32]float64
+	asks map[uint64]map[int32]float64
+	// competing price we last alerted about, by order
+	// so we don't send the same alert after every snapshot
+	alerted map[int64]float64
+	// competing price of the alerts that are still being sent, by order
+	sending map[int64]float64
+	// alerts that are still being sent
+	wg sync.WaitGroup
+}
+
+// construct a new watcher that sends its alerts to the notifier
+func NewAlertWatcher(watchlist []orderbookfetcher.WatchlistEntry, notifier orderbookfetcher.Notifier) *AlertWatcher {
+	w := &AlertWatcher{
+		notifier:  notifier,
+		watchlist: make(map[uint64][]orderbookfetcher.WatchlistEntry),
+		bids:      make(map[uint64]map[int32]float64),
+		asks:      make(map[uint64]map[int32]float64),
+		alerted:   make(map[int64]float64),
+		sending:   make(map[int64]float64),
+	}
+	for _, entry := range watchlist {
+		w.watchlist[entry.Location] = append(w.watchlist[entry.Location], entry)
+	}
+	return w
+}
+
+// check the watchlist entries of the snapshot's location
+func (w *AlertWatcher) HandleSnapshot(snapshot *orderbookfetcher.Snapshot) error {
+	entries, ok := w.watchlist[snapshot.Info.LocationID]
+	if !ok {
+		return nil
+	}
+
+	w.mu.Lock()
+	var alerts []*orderbookfetcher.Alert
+	for _, entry := range entries {
+		alerts = append(alerts, w.checkOrders(snapshot, entry)...)
+	}
+	alerts = append(alerts, w.checkPrices(snapshot, entries)...)
+	w.mu.Unlock()
+
+	// the notifiers can take a while, don't hold up the fetcher
+	for _, alert := range alerts {
+		log.Print(alert.Message)
+		w.wg.Add(1)
+		go w.send(alert)
+	}
+	return nil
+}
+
+// wait for the alerts that are still being sent,
+// the fetcher has to be shut down first so no new ones come in
+func (w *AlertWatcher) Shutdown() {
+	w.wg.Wait()
+}
+
+// send the alert, an order only counts as alerted once that succeeded
+func (w *AlertWatcher) send(alert *orderbookfetcher.Alert) {
+	defer w.wg.Done()
+	err := w.notifier.Notify(alert)
+	if err != nil {
+		log.Printf("failed to send alert: %s", err)
+	}
+	if alert.OrderID == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// the order might have been filled or caught up with in the meantime
+	if price, ok := w.sending[alert.OrderID]; ok && price == alert.OtherPrice {
+		delete(w.sending, alert.OrderID)
+		if err == nil {
+			w.alerted[alert.OrderID] = alert.OtherPrice
+		}
+	}
+}
+
+// did anyone undercut or outbid our orders?
+func (w *AlertWatcher) checkOrders(snapshot *orderbookfetcher.Snapshot, entry orderbookfetcher.WatchlistEntry) []*orderbookfetcher.Alert {
+	if len(entry.Orders) == 0 {
+		return nil
+	}
+	ours := make(map[int64]*orderbookfetcher.MarketOrder, len(entry.Orders))
+	for _, id := range entry.Orders {
+		ours[id] = nil
+	}
+	for _, order := range snapshot.Orders {
+		if _, ok := ours[order.OrderID]; ok {
+			ours[order.OrderID] = order
+		}
+	}
+
+	var alerts []*orderbookfetcher.Alert
+	for id, order := range ours {
+		if order == nil {
+			// no longer on the market
+			delete(w.alerted, id)
+			delete(w.sending, id)
+			continue
+		}
+		best, ok := bestCompetitor(snapshot.Orders, order, ours)
+		price := float64(order.Price)
+		beaten := ok && ((order.IsBuyOrder && best > price) || (!order.IsBuyOrder && best < price))
+		if !beaten {
+			delete(w.alerted, id)
+			delete(w.sending, id)
+			continue
+		}
+		if last, ok := w.alerted[id]; ok && last == best {
+			continue
+		}
+		if pending, ok := w.sending[id]; ok && pending == best {
+			continue
+		}
+		w.sending[id] = best
+
+		alert := &orderbookfetcher.Alert{
+			Kind:         orderbookfetcher.AlertUndercut,
+			Time:         snapshot.Info.Date,
+			LocationID:   snapshot.Info.LocationID,
+			LocationName: snapshot.Info.LocationName,
+			TypeID:       order.TypeID,
+			OrderID:      order.OrderID,
+			IsBuyOrder:   order.IsBuyOrder,
+			Price:        price,
+			OtherPrice:   best,
+		}
+		alert.Message = fmt.Sprintf("sell order %d for type %d at %s has been undercut: %.2f < %.2f", order.OrderID, order.TypeID, snapshot.Info.LocationName, best, price)
+		if order.IsBuyOrder {
+			alert.Kind = orderbookfetcher.AlertOutbid
+			alert.Message = fmt.Sprintf("buy order %d for type %d at %s has been outbid: %.2f > %.2f", order.OrderID, order.TypeID, snapshot.Info.LocationName, best, price)
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// did the best price of a watched type move by more than the threshold?
+func (w *AlertWatcher) checkPrices(snapshot *orderbookfetcher.Snapshot, entries []orderbookfetcher.WatchlistEntry) []*orderbookfetcher.Alert {
+	location := snapshot.Info.LocationID
+	bids, asks := bestPrices(snapshot.Orders)
+	previousBids, previousAsks := w.bids[location], w.asks[location]
+	w.bids[location], w.asks[location] = bids, asks
+	if previousBids == nil {
+		// nothing to compare against yet
+		return nil
+	}
+
+	var alerts []*orderbookfetcher.Alert
+	for _, entry := range entries {
+		if entry.Threshold == 0 {
+			// price alerts are disabled
+			continue
+		}
+		for _, typeID := range entry.Types {
+			for _, side := range []struct {
+				isBuy           bool
+				current, before map[int32]float64
+			}{
+				{isBuy: true, current: bids, before: previousBids},
+				{isBuy: false, current: asks, before: previousAsks},
+			} {
+				price, ok := side.current[typeID]
+				previous, hadPrevious := side.before[typeID]
+				if !ok || !hadPrevious || previous == 0 {
+					continue
+				}
+				change := (price - previous) / previous
+				if math.Abs(change) <= entry.Threshold {
+					continue
+				}
+				name := "sell"
+				if side.isBuy {
+					name = "buy"
+				}
+				alerts = append(alerts, &orderbookfetcher.Alert{
+					Kind:         orderbookfetcher.AlertPriceMove,
+					Time:         snapshot.Info.Date,
+					LocationID:   location,
+					LocationName: snapshot.Info.LocationName,
+					TypeID:       typeID,
+					IsBuyOrder:   side.isBuy,
+					Price:        price,
+					OtherPrice:   previous,
+					Message:      fmt.Sprintf("best %s price of type %d at %s moved by %+.1f%%: %.2f -> %.2f", name, typeID, snapshot.Info.LocationName, change*100, previous, price),
+				})
+			}
+		}
+	}
+	return alerts
+}
+
+// best price of the other orders on the same side, for the same type at the same station
+func bestCompetitor(orders []*orderbookfetcher.MarketOrder, ours *orderbookfetcher.MarketOrder, own map[int64]*orderbookfetcher.MarketOrder) (float64, bool) {
+	var best float64
+	found := false
+	for _, order := range orders {
+		if order.TypeID != ours.TypeID || order.LocationID != ours.LocationID || order.IsBuyOrder != ours.IsBuyOrder {
+			continue
+		}
+		if _, ok := own[order.OrderID]; ok {
+			continue
+		}
+		price := float64(order.Price)
+		if !found || (ours.IsBuyOrder && price > best) || (!ours.IsBuyOrder && price < best) {
+			best, found = price, true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,265 @@
+package market
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// assure interface compliance
+var _ orderbookfetcher.SnapshotHandler = (*ArbitrageScanner)(nil)
+var _ orderbookfetcher.EventHandler = (*ArbitrageScanner)(nil)
+var _ orderbookfetcher.ArbitrageService = (*ArbitrageScanner)(nil)
+
+// compares the latest orderbooks of the configured locations
+// and looks for types that can be bought at a station of one and sold at a station of another for a profit
+type ArbitrageScanner struct {
+	mu sync.RWMutex
+
+	// csv file the report is written to
+	reportFile string
+	fees       orderbookfetcher.Fees
+	config     orderbookfetcher.ArbitrageConfig
+
+	// latest orderbook per location
+	books map[uint64]*locationBook
+	// result of the last scan
+	report *orderbookfetcher.ArbitrageReport
+}
+
+type locationBook struct {
+	name  string
+	types map[int32]*typeBook
+}
+
+// construct a new scanner that writes its report to reportFile
+func NewArbitrageScanner(reportFile string, fees orderbookfetcher.Fees, config orderbookfetcher.ArbitrageConfig) *ArbitrageScanner {
+	return &ArbitrageScanner{
+		reportFile: reportFile,
+		fees:       fees,
+		config:     config,
+		books:      make(map[uint64]*locationBook),
+		report:     &orderbookfetcher.ArbitrageReport{Opportunities: []*orderbookfetcher.ArbitrageOpportunity{}},
+	}
+}
+
+// replace the orderbook of the location and scan every pair of locations again
+func (s *ArbitrageScanner) HandleSnapshot(snapshot *orderbookfetcher.Snapshot) error {
+	location := snapshot.Info.LocationID
+	if !s.scanning(location) {
+		return nil
+	}
+	// region orderbooks contain the orders of the citadels in the region,
+	// the citadels that are fetched themselves are only compared with their own book.
+	// a citadel that's added later drops out of the region with its next snapshot
+	s.mu.RLock()
+	ownBooks := make(map[int64]struct{}, len(s.books))
+	for id := range s.books {
+		if id != location {
+			ownBooks[int64(id)] = struct{}{}
+		}
+	}
+	s.mu.RUnlock()
+	book := &locationBook{
+		name: snapshot.Info.LocationName,
+		types: buildBooks(snapshot.Orders, func(station int64) bool {
+			_, ok := ownBooks[station]
+			return ok
+		}),
+	}
+
+	s.mu.Lock()
+	s.books[snapshot.Info.LocationID] = book
+	report := s.scan()
+	s.report = report
+	s.mu.Unlock()
+
+	return s.writeReport(report)
+}
+
+// forget about the book of a location that isn't fetched anymore
+func (s *ArbitrageScanner) HandleEvent(event *orderbookfetcher.Event) {
+	if event.Type != orderbookfetcher.EventLocationRemoved {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.books[event.LocationID]; !ok {
+		return
+	}
+	delete(s.books, event.LocationID)
+	// don't scan again, only drop the opportunities of the location
+	report := &orderbookfetcher.ArbitrageReport{
+		Generated:     s.report.Generated,
+		Opportunities: make([]*orderbookfetcher.ArbitrageOpportunity, 0, len(s.report.Opportunities)),
+	}
+	for _, opportunity := range s.report.Opportunities {
+		if opportunity.From != event.LocationID && opportunity.To != event.LocationID {
+			report.Opportunities = append(report.Opportunities, opportunity)
+		}
+	}
+	s.report = report
+}
+
+// the result of the last scan
+func (s *ArbitrageScanner) ArbitrageReport() *orderbookfetcher.ArbitrageReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.report
+}
+
+// are we comparing this location?
+func (s *ArbitrageScanner) scanning(location uint64) bool {
+	if len(s.config.Locations) == 0 {
+		return true
+	}
+	for _, l := range s.config.Locations {
+		if l == location {
+			return true
+		}
+	}
+	return false
+}
+
+// compare every location against every other one
+func (s *ArbitrageScanner) scan() *orderbookfetcher.ArbitrageReport {
+	report := &orderbookfetcher.ArbitrageReport{
+		Generated:     time.Now().UTC(),
+		Opportunities: []*orderbookfetcher.ArbitrageOpportunity{},
+	}
+	for from, source := range s.books {
+		for to, destination := range s.books {
+			if from == to {
+				continue
+			}
+			for typeID, sourceBook := range source.types {
+				destinationBook, ok := destination.types[typeID]
+				if !ok {
+					continue
+				}
+				opportunity := s.bestStations(sourceBook, destinationBook)
+				if opportunity == nil {
+					continue
+				}
+				opportunity.TypeID = typeID
+				opportunity.From, opportunity.FromName = from, source.name
+				opportunity.To, opportunity.ToName = to, destination.name
+				report.Opportunities = append(report.Opportunities, opportunity)
+			}
+		}
+	}
+	sort.Slice(report.Opportunities, func(i, j int) bool {
+		return report.Opportunities[i].Profit > report.Opportunities[j].Profit
+	})
+	return report
+}
+
+// the most profitable pair of stations to buy and sell a type at
+func (s *ArbitrageScanner) bestStations(source, destination *typeBook) *orderbookfetcher.ArbitrageOpportunity {
+	var best *orderbookfetcher.ArbitrageOpportunity
+	for fromStation, sells := range source.sells {
+		for toStation, buys := range destination.buys {
+			if fromStation == toStation {
+				continue
+			}
+			opportunity := s.match(sells, buys)
+			if opportunity == nil || opportunity.Volume < s.config.MinVolume || opportunity.Profit < s.config.MinProfit {
+				continue
+			}
+			if best == nil || opportunity.Profit > best.Profit {
+				opportunity.FromStation, opportunity.ToStation = fromStation, toStation
+				best = opportunity
+			}
+		}
+	}
+	return best
+}
+
+// buy the cheapest sell orders and sell them into the highest buy orders
+// for as long as that is profitable after fees
+func (s *ArbitrageScanner) match(sells, buys []level) *orderbookfetcher.ArbitrageOpportunity {
+	opportunity := &orderbookfetcher.ArbitrageOpportunity{
+		BuyPrice:  sells[0].price,
+		SellPrice: buys[0].price,
+	}
+	// volume left on the current levels
+	sellVolume, buyVolume := sells[0].volume, buys[0].volume
+	for i, j := 0, 0; i < len(sells) && j < len(buys); {
+		cost := sells[i].price * (1 + s.fees.BrokerFee)
+		revenue := buys[j].price * (1 - s.fees.SalesTax)
+		if revenue <= cost {
+			break
+		}
+		volume := sellVolume
+		if buyVolume < volume {
+			volume = buyVolume
+		}
+		opportunity.Volume += volume
+		opportunity.Cost += cost * float64(volume)
+		opportunity.Revenue += revenue * float64(volume)
+
+		// move on to the next level on whatever side has been used up
+		if sellVolume -= volume; sellVolume == 0 {
+			if i++; i < len(sells) {
+				sellVolume = sells[i].volume
+			}
+		}
+		if buyVolume -= volume; buyVolume == 0 {
+			if j++; j < len(buys) {
+				buyVolume = buys[j].volume
+			}
+		}
+	}
+	if opportunity.Volume == 0 {
+		return nil
+	}
+	opportunity.Profit = opportunity.Revenue - opportunity.Cost
+	opportunity.Margin = opportunity.Profit / opportunity.Cost
+	return opportunity
+}
+
+// write the report as a csv file
+func (s *ArbitrageScanner) writeReport(report *orderbookfetcher.ArbitrageReport) error {
+	if err := os.MkdirAll(filepath.Dir(s.reportFile), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(s.reportFile + ".tmp")
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"TYPEID", "FROM", "FROMNAME", "FROMSTATION", "TO", "TONAME", "TOSTATION", "BUYPRICE", "SELLPRICE", "VOLUME", "COST", "REVENUE", "PROFIT", "MARGIN"})
+	for _, o := range report.Opportunities {
+		writer.Write([]string{
+			strconv.FormatInt(int64(o.TypeID), 10),
+			strconv.FormatUint(o.From, 10),
+			o.FromName,
+			strconv.FormatInt(o.FromStation, 10),
+			strconv.FormatUint(o.To, 10),
+			o.ToName,
+			strconv.FormatInt(o.ToStation, 10),
+			formatFloat(o.BuyPrice),
+			formatFloat(o.SellPrice),
+			strconv.FormatInt(o.Volume, 10),
+			formatFloat(o.Cost),
+			formatFloat(o.Revenue),
+			formatFloat(o.Profit),
+			formatFloat(o.Margin),
+		})
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), s.reportFile)
+}
@@ -0,0 +1,126 @@
+package market
+
+import (
+	"path/filepath"
+	"testing"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// stations and their systems
+const (
+	jita          = 60003760
+	jitaSystem    = 30000142
+	citadel       = 1035466617946
+	dodixie       = 60011866
+	dodixie2      = 60011867
+	dodixieSystem = 30002659
+	other         = 60011740
+	otherSystem   = 30002661
+)
+
+func arbitrageOrder(station int64, system int32, isBuy bool, orderRange string, price float32, volume int32) *orderbookfetcher.MarketOrder {
+	return &orderbookfetcher.MarketOrder{
+		TypeID:       34,
+		LocationID:   station,
+		SystemID:     system,
+		IsBuyOrder:   isBuy,
+		Range:        orderRange,
+		Price:        price,
+		VolumeRemain: volume,
+	}
+}
+
+func arbitrageSnapshot(location uint64, orders ...*orderbookfetcher.MarketOrder) *orderbookfetcher.Snapshot {
+	return &orderbookfetcher.Snapshot{
+		Info:   &orderbookfetcher.OrderbookInfo{LocationID: location},
+		Orders: orders,
+	}
+}
+
+// the opportunities by source location
+func opportunities(s *ArbitrageScanner) map[uint64]*orderbookfetcher.ArbitrageOpportunity {
+	byFrom := make(map[uint64]*orderbookfetcher.ArbitrageOpportunity)
+	for _, opportunity := range s.ArbitrageReport().Opportunities {
+		byFrom[opportunity.From] = opportunity
+	}
+	return byFrom
+}
+
+func TestArbitrageStations(t *testing.T) {
+	scanner := NewArbitrageScanner(filepath.Join(t.TempDir(), "arbitrage.csv"), orderbookfetcher.Fees{}, orderbookfetcher.ArbitrageConfig{})
+
+	steps := []*orderbookfetcher.Snapshot{
+		arbitrageSnapshot(citadel,
+			arbitrageOrder(citadel, jitaSystem, false, "region", 4, 10),
+		),
+		// the region contains the orders of the citadel
+		arbitrageSnapshot(10000002,
+			arbitrageOrder(jita, jitaSystem, false, "region", 5, 100),
+			arbitrageOrder(citadel, jitaSystem, false, "region", 4, 10),
+		),
+		arbitrageSnapshot(10000032,
+			// only one of them can be sold into at the same station
+			arbitrageOrder(dodixie, dodixieSystem, true, "station", 10, 50),
+			arbitrageOrder(other, otherSystem, true, "station", 10, 50),
+			// reaches every station in the system
+			arbitrageOrder(dodixie2, dodixieSystem, true, "solarsystem", 9, 20),
+			// reaches only its own system, we don't know how far 5 jumps go
+			arbitrageOrder(other, otherSystem, true, "5", 8, 20),
+			// reaches everywhere
+			arbitrageOrder(other, otherSystem, true, "region", 6, 5),
+		),
+	}
+	for _, snapshot := range steps {
+		if err := scanner.HandleSnapshot(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	byFrom := opportunities(scanner)
+	region, ok := byFrom[10000002]
+	if !ok {
+		t.Fatal("no opportunity from the region")
+	}
+	if region.FromStation != jita {
+		t.Errorf("the citadel's orders are part of the region's book, bought at %d", region.FromStation)
+	}
+	// 50 at 10 and 20 at 9 at dodixie, plus 5 at 6 from anywhere in the region
+	if region.ToStation != dodixie || region.Volume != 75 {
+		t.Errorf("expected to sell 75 at %d, got %d at %d", dodixie, region.Volume, region.ToStation)
+	}
+	if profit := 50*5 + 20*4 + 5*1.0; region.Profit != profit {
+		t.Errorf("expected a profit of %.0f, got %.0f", profit, region.Profit)
+	}
+
+	fromCitadel, ok := byFrom[citadel]
+	if !ok {
+		t.Fatal("no opportunity from the citadel")
+	}
+	if fromCitadel.FromStation != citadel || fromCitadel.Volume != 10 {
+		t.Errorf("unexpected opportunity from the citadel %+v", fromCitadel)
+	}
+}
+
+func TestArbitrageRemovedLocation(t *testing.T) {
+	scanner := NewArbitrageScanner(filepath.Join(t.TempDir(), "arbitrage.csv"), orderbookfetcher.Fees{}, orderbookfetcher.ArbitrageConfig{})
+	for _, snapshot := range []*orderbookfetcher.Snapshot{
+		arbitrageSnapshot(10000002, arbitrageOrder(jita, jitaSystem, false, "region", 5, 100)),
+		arbitrageSnapshot(10000032, arbitrageOrder(dodixie, dodixieSystem, true, "region", 10, 50)),
+	} {
+		if err := scanner.HandleSnapshot(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(scanner.ArbitrageReport().Opportunities) != 1 {
+		t.Fatalf("expected an opportunity, got %d", len(scanner.ArbitrageReport().Opportunities))
+	}
+
+	scanner.HandleEvent(&orderbookfetcher.Event{Type: orderbookfetcher.EventLocationRemoved, LocationID: 10000032})
+	if _, ok := scanner.books[10000032]; ok {
+		t.Error("the book of the removed location is still there")
+	}
+	if n := len(scanner.ArbitrageReport().Opportunities); n != 0 {
+		t.Errorf("expected the opportunities of the removed location to be gone, got %d", n)
+	}
+}
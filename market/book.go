@@ -0,0 +1,128 @@
+package market
+
+import (
+	"sort"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// volume available at a price
+type level struct {
+	price  float64
+	volume int64
+}
+
+// both sides of the market of a single type, by the station they can be traded at
+type typeBook struct {
+	// sell orders by the station they are at, lowest price first
+	sells map[int64][]level
+	// buy orders whose range reaches the station, by station, highest price first
+	buys map[int64][]level
+}
+
+// the buy orders of a type, grouped by how far they reach
+type buyOrders struct {
+	// reach every station of the region
+	region map[float64]int64
+	// reach every station of their system, by system
+	system map[int64]map[float64]int64
+	// only reach their own station, by station
+	station map[int64]map[float64]int64
+	// system of every station with buy orders
+	stations map[int64]int32
+}
+
+// aggregate the orders into price levels per type and station.
+// orders at stations that have a book of their own (citadels inside a region) are left out
+func buildBooks(orders []*orderbookfetcher.MarketOrder, ownBook func(station int64) bool) map[int32]*typeBook {
+	sells := make(map[int32]map[int64]map[float64]int64)
+	buys := make(map[int32]*buyOrders)
+	for _, order := range orders {
+		if ownBook(order.LocationID) {
+			continue
+		}
+		volume := int64(order.VolumeRemain)
+		price := float64(order.Price)
+		if !order.IsBuyOrder {
+			stations, ok := sells[order.TypeID]
+			if !ok {
+				stations = make(map[int64]map[float64]int64)
+				sells[order.TypeID] = stations
+			}
+			addLevel(stations, order.LocationID, price, volume)
+			continue
+		}
+
+		b, ok := buys[order.TypeID]
+		if !ok {
+			b = &buyOrders{
+				region:   make(map[float64]int64),
+				system:   make(map[int64]map[float64]int64),
+				station:  make(map[int64]map[float64]int64),
+				stations: make(map[int64]int32),
+			}
+			buys[order.TypeID] = b
+		}
+		b.stations[order.LocationID] = order.SystemID
+		switch order.Range {
+		case "region":
+			b.region[price] += volume
+		case "station":
+			addLevel(b.station, order.LocationID, price, volume)
+		default:
+			// "solarsystem" or a number of jumps, we don't know the map
+			// so the jumps only count within the system
+			addLevel(b.system, int64(order.SystemID), price, volume)
+		}
+	}
+
+	books := make(map[int32]*typeBook)
+	book := func(typeID int32) *typeBook {
+		b, ok := books[typeID]
+		if !ok {
+			b = &typeBook{sells: make(map[int64][]level), buys: make(map[int64][]level)}
+			books[typeID] = b
+		}
+		return b
+	}
+	for typeID, stations := range sells {
+		b := book(typeID)
+		for station, levels := range stations {
+			b.sells[station] = sortedLevels(levels, func(a, b float64) bool { return a < b })
+		}
+	}
+	for typeID, orders := range buys {
+		b := book(typeID)
+		// only the stations with buy orders are candidates,
+		// any other station can't be reached by more than those in its system
+		for station, system := range orders.stations {
+			levels := make(map[float64]int64)
+			for _, reaching := range []map[float64]int64{orders.region, orders.system[int64(system)], orders.station[station]} {
+				for price, volume := range reaching {
+					levels[price] += volume
+				}
+			}
+			b.buys[station] = sortedLevels(levels, func(a, b float64) bool { return a > b })
+		}
+	}
+	return books
+}
+
+// add volume to the price levels of a station or system
+func addLevel(levels map[int64]map[float64]int64, key int64, price float64, volume int64) {
+	prices, ok := levels[key]
+	if !ok {
+		prices = make(map[float64]int64)
+		levels[key] = prices
+	}
+	prices[price] += volume
+}
+
+func sortedLevels(levels map[float64]int64, less func(a, b float64) bool) []level {
+	sorted := make([]level, 0, len(levels))
+	for price, volume := range levels {
+		sorted = append(sorted, level{price: price, volume: volume})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return less(sorted[i].price, sorted[j].price) })
+	return sorted
+}
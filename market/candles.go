@@ -0,0 +1,184 @@
+package market
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// assure interface compliance
+var _ orderbookfetcher.SnapshotHandler = (*CandleStore)(nil)
+var _ orderbookfetcher.CandleService = (*CandleStore)(nil)
+
+// aggregates the best prices of every snapshot into candles.
+// every bucket is kept in its own file ({location}/{bucket}/{start}.json),
+// so a new snapshot only rewrites the bucket that is currently open
+type CandleStore struct {
+	mu sync.Mutex
+
+	// where the candle files are stored
+	dir string
+	// bucket sizes we are aggregating into
+	buckets []orderbookfetcher.Duration
+	// the candles of the currently open bucket per location and bucket size
+	open map[candleKey]*openBucket
+}
+
+type candleKey struct {
+	location uint64
+	bucket   orderbookfetcher.Duration
+}
+
+type openBucket struct {
+	start time.Time
+	// candles by type id
+	candles map[int32]*orderbookfetcher.Candle
+}
+
+// construct a new candle store that keeps its files in dir
+func NewCandleStore(dir string, buckets []orderbookfetcher.Duration) *CandleStore {
+	return &CandleStore{
+		dir:     dir,
+		buckets: buckets,
+		open:    make(map[candleKey]*openBucket),
+	}
+}
+
+// update the open candles with the best prices of the snapshot
+func (s *CandleStore) HandleSnapshot(snapshot *orderbookfetcher.Snapshot) error {
+	bids, asks := bestPrices(snapshot.Orders)
+	location := snapshot.Info.LocationID
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, bucket := range s.buckets {
+		key := candleKey{location: location, bucket: bucket}
+		start := snapshot.Info.Date.Truncate(time.Duration(bucket)).UTC()
+
+		// did the snapshot open a new bucket?
+		open := s.open[key]
+		if open == nil || !open.start.Equal(start) {
+			candles, err := s.readBucket(location, bucket, start)
+			if err != nil {
+				return err
+			}
+			open = &openBucket{start: start, candles: candles}
+			s.open[key] = open
+		}
+
+		for typeID := range types(bids, asks) {
+			candle := s.candle(open, location, bucket, typeID)
+			bid, hasBid := bids[typeID]
+			ask, hasAsk := asks[typeID]
+			if hasBid {
+				candle.Bid = updateOHLC(candle.Bid, bid)
+			}
+			if hasAsk {
+				candle.Ask = updateOHLC(candle.Ask, ask)
+			}
+			if hasBid && hasAsk {
+				candle.Mid = updateOHLC(candle.Mid, (bid+ask)/2)
+			}
+			candle.Snapshots++
+		}
+
+		if err := writeJSONFile(s.bucketFile(location, bucket, start), open.candles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// candles for the type at the location, with a start within [from, to]
+func (s *CandleStore) FindCandles(location uint64, typeID int32, bucket orderbookfetcher.Duration, from, to time.Time) ([]*orderbookfetcher.Candle, error) {
+	dir := filepath.Join(s.dir, strconv.FormatUint(location, 10), bucket.String())
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []*orderbookfetcher.Candle{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// the bucket containing from starts before it
+	from = from.Truncate(time.Duration(bucket))
+	var starts []time.Time
+	for _, entry := range entries {
+		unix, err := strconv.ParseInt(strings.TrimSuffix(entry.Name(), ".json"), 10, 64)
+		if err != nil || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		start := time.Unix(unix, 0).UTC()
+		if !start.Before(from) && !start.After(to) {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	candles := make([]*orderbookfetcher.Candle, 0, len(starts))
+	for _, start := range starts {
+		bucketCandles, err := s.readBucket(location, bucket, start)
+		if err != nil {
+			return nil, err
+		}
+		if candle, ok := bucketCandles[typeID]; ok {
+			candles = append(candles, candle)
+		}
+	}
+	return candles, nil
+}
+
+// get the candle for a type from the bucket, creating it if it doesn't exist yet
+func (s *CandleStore) candle(open *openBucket, location uint64, bucket orderbookfetcher.Duration, typeID int32) *orderbookfetcher.Candle {
+	candle, ok := open.candles[typeID]
+	if !ok {
+		candle = &orderbookfetcher.Candle{
+			TypeID:     typeID,
+			LocationID: location,
+			Start:      open.start,
+			Bucket:     bucket,
+		}
+		open.candles[typeID] = candle
+	}
+	return candle
+}
+
+// read the candles of a bucket from disk, an empty bucket if there is no file yet
+func (s *CandleStore) readBucket(location uint64, bucket orderbookfetcher.Duration, start time.Time) (map[int32]*orderbookfetcher.Candle, error) {
+	candles := make(map[int32]*orderbookfetcher.Candle)
+	err := readJSONFile(s.bucketFile(location, bucket, start), &candles)
+	if errors.Is(err, fs.ErrNotExist) {
+		return candles, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read candles: %w", err)
+	}
+	return candles, nil
+}
+
+func (s *CandleStore) bucketFile(location uint64, bucket orderbookfetcher.Duration, start time.Time) string {
+	return filepath.Join(s.dir, strconv.FormatUint(location, 10), bucket.String(), fmt.Sprintf("%d.json", start.Unix()))
+}
+
+// add a price to the ohlc, opening it if it doesn't exist yet
+func updateOHLC(ohlc *orderbookfetcher.OHLC, price float64) *orderbookfetcher.OHLC {
+	if ohlc == nil {
+		return &orderbookfetcher.OHLC{Open: price, High: price, Low: price, Close: price}
+	}
+	if price > ohlc.High {
+		ohlc.High = price
+	}
+	if price < ohlc.Low {
+		ohlc.Low = price
+	}
+	ohlc.Close = price
+	return ohlc
+}
@@ -0,0 +1,43 @@
+package market
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// encode v as json and replace the file in one go,
+// so readers never see a partially written file
+func writeJSONFile(fileName string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(fileName + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(file).Encode(v); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), fileName)
+}
+
+// decode a json file into v
+func readJSONFile(fileName string, v any) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return json.NewDecoder(file).Decode(v)
+}
+
+// format a float for the csv reports
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 6, 64)
+}
@@ -0,0 +1,285 @@
+package market
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// assure interface compliance
+var _ orderbookfetcher.SnapshotHandler = (*LifecycleTracker)(nil)
+
+// follows every order across the snapshots of a location.
+// open orders are kept in {location}/open.json, which is rewritten after every snapshot,
+// finished orders are appended to {location}/finished/{date}.ndjson
+type LifecycleTracker struct {
+	mu sync.Mutex
+
+	// where the state is stored
+	dir string
+	// tracked orders per location
+	locations map[uint64]*trackedLocation
+}
+
+// for how many days are we keeping the traded volume?
+const tradedVolumeDays = 30
+
+// everything we know about the orders of a location
+type trackedLocation struct {
+	// expiry of the first and the last snapshot we processed
+	FirstSnapshot time.Time `json:"firstSnapshot"`
+	LastSnapshot  time.Time `json:"lastSnapshot"`
+	// orders that were still on the market in the last snapshot
+	Orders map[int64]*orderbookfetcher.OrderLifecycle `json:"orders"`
+	// volume traded per day ("2006-01-02") by station and type ("{station}_{type}")
+	Traded map[string]map[string]int64 `json:"traded"`
+}
+
+// construct a new tracker that keeps its state in dir
+func NewLifecycleTracker(dir string) *LifecycleTracker {
+	return &LifecycleTracker{
+		dir:       dir,
+		locations: make(map[uint64]*trackedLocation),
+	}
+}
+
+// compare the snapshot to the previous one of the location
+func (t *LifecycleTracker) HandleSnapshot(snapshot *orderbookfetcher.Snapshot) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	location, err := t.location(snapshot.Info.LocationID)
+	if err != nil {
+		return err
+	}
+	now := snapshot.Info.Date
+	if !now.After(location.LastSnapshot) {
+		// we've already seen this one
+		return nil
+	}
+
+	seen := make(map[int64]struct{}, len(snapshot.Orders))
+	for _, order := range snapshot.Orders {
+		seen[order.OrderID] = struct{}{}
+		tracked, ok := location.Orders[order.OrderID]
+		if !ok {
+			location.Orders[order.OrderID] = newOrderLifecycle(order, now)
+			continue
+		}
+		tracked.LastSeen = now
+		if last := tracked.Prices[len(tracked.Prices)-1]; last.Price != order.Price {
+			tracked.Prices = append(tracked.Prices, orderbookfetcher.PricePoint{Time: now, Price: order.Price})
+		}
+		if last := tracked.Volumes[len(tracked.Volumes)-1]; last.VolumeRemain != order.VolumeRemain {
+			tracked.Volumes = append(tracked.Volumes, orderbookfetcher.VolumePoint{Time: now, VolumeRemain: order.VolumeRemain})
+			if last.VolumeRemain > order.VolumeRemain {
+				location.addTraded(tracked, now, int64(last.VolumeRemain-order.VolumeRemain))
+			}
+		}
+	}
+
+	// every order that's missing from the snapshot has finished
+	var finished []*orderbookfetcher.OrderLifecycle
+	for id, tracked := range location.Orders {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		// only the trades we have seen count towards the volume, not what was left when it vanished
+		finishOrder(tracked, now)
+		finished = append(finished, tracked)
+		delete(location.Orders, id)
+	}
+	if location.FirstSnapshot.IsZero() {
+		location.FirstSnapshot = now
+	}
+	location.LastSnapshot = now
+	location.pruneTraded(now)
+
+	if err := t.appendFinished(snapshot.Info.LocationID, now, finished); err != nil {
+		return err
+	}
+	return writeJSONFile(t.openFile(snapshot.Info.LocationID), location)
+}
+
+// look up an order that is still open
+func (t *LifecycleTracker) Order(location uint64, orderID int64) (*orderbookfetcher.OrderLifecycle, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tracked, ok := t.locations[location]
+	if !ok {
+		return nil, false
+	}
+	order, ok := tracked.Orders[orderID]
+	if !ok {
+		return nil, false
+	}
+	// hand out a copy, the tracker keeps updating the original
+	copied := *order
+	copied.Prices = append([]orderbookfetcher.PricePoint(nil), order.Prices...)
+	copied.Volumes = append([]orderbookfetcher.VolumePoint(nil), order.Volumes...)
+	return &copied, true
+}
+
+// average volume traded per day of a type at a station,
+// over the last week of days that we have watched completely
+func (t *LifecycleTracker) DailyVolume(location uint64, station int64, typeID int32) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tracked, ok := t.locations[location]
+	if !ok {
+		return 0, false
+	}
+
+	day := 24 * time.Hour
+	today := tracked.LastSnapshot.UTC().Truncate(day)
+	first := tracked.FirstSnapshot.UTC().Truncate(day).Add(day)
+	if weekAgo := today.AddDate(0, 0, -7); first.Before(weekAgo) {
+		first = weekAgo
+	}
+	days := int(today.Sub(first) / day)
+	if days <= 0 {
+		return 0, false
+	}
+
+	var total int64
+	for date, volume := range tracked.Traded[tradedKey(station, typeID)] {
+		d, err := time.Parse("2006-01-02", date)
+		if err == nil && !d.Before(first) && d.Before(today) {
+			total += volume
+		}
+	}
+	return float64(total) / float64(days), true
+}
+
+// get the state of a location, loading it from disk the first time
+func (t *LifecycleTracker) location(id uint64) (*trackedLocation, error) {
+	if location, ok := t.locations[id]; ok {
+		return location, nil
+	}
+	location := &trackedLocation{}
+	err := readJSONFile(t.openFile(id), location)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load the order state: %w", err)
+	}
+	if location.Orders == nil {
+		location.Orders = make(map[int64]*orderbookfetcher.OrderLifecycle)
+	}
+	if location.Traded == nil {
+		location.Traded = make(map[string]map[string]int64)
+	}
+	t.locations[id] = location
+	return location, nil
+}
+
+// append the finished orders to the file of the day
+func (t *LifecycleTracker) appendFinished(location uint64, now time.Time, finished []*orderbookfetcher.OrderLifecycle) error {
+	if len(finished) == 0 {
+		return nil
+	}
+	dir := filepath.Join(t.dir, strconv.FormatUint(location, 10), "finished")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, now.UTC().Format("2006-01-02")+".ndjson"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, order := range finished {
+		if err = encoder.Encode(order); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+func (t *LifecycleTracker) openFile(location uint64) string {
+	return filepath.Join(t.dir, strconv.FormatUint(location, 10), "open.json")
+}
+
+// add to the volume of the order's type that has been traded on the day
+func (l *trackedLocation) addTraded(order *orderbookfetcher.OrderLifecycle, now time.Time, volume int64) {
+	key := tradedKey(order.LocationID, order.TypeID)
+	days, ok := l.Traded[key]
+	if !ok {
+		days = make(map[string]int64)
+		l.Traded[key] = days
+	}
+	days[now.UTC().Format("2006-01-02")] += volume
+}
+
+// forget about the volume traded on days we're no longer keeping
+func (l *trackedLocation) pruneTraded(now time.Time) {
+	oldest := now.UTC().AddDate(0, 0, -tradedVolumeDays).Format("2006-01-02")
+	for key, days := range l.Traded {
+		for date := range days {
+			// the dates sort lexicographically
+			if date < oldest {
+				delete(days, date)
+			}
+		}
+		if len(days) == 0 {
+			delete(l.Traded, key)
+		}
+	}
+}
+
+func tradedKey(station int64, typeID int32) string {
+	return fmt.Sprintf("%d_%d", station, typeID)
+}
+
+// start tracking an order we haven't seen before
+func newOrderLifecycle(order *orderbookfetcher.MarketOrder, now time.Time) *orderbookfetcher.OrderLifecycle {
+	return &orderbookfetcher.OrderLifecycle{
+		OrderID:     order.OrderID,
+		TypeID:      order.TypeID,
+		LocationID:  order.LocationID,
+		SystemID:    order.SystemID,
+		IsBuyOrder:  order.IsBuyOrder,
+		Issued:      order.Issued,
+		Duration:    order.Duration,
+		VolumeTotal: order.VolumeTotal,
+		FirstSeen:   now,
+		LastSeen:    now,
+		Prices:      []orderbookfetcher.PricePoint{{Time: now, Price: order.Price}},
+		Volumes:     []orderbookfetcher.VolumePoint{{Time: now, VolumeRemain: order.VolumeRemain}},
+		State:       orderbookfetcher.OrderOpen,
+	}
+}
+
+// decide how an order that disappeared at now has ended, see the states for the heuristic
+func finishOrder(order *orderbookfetcher.OrderLifecycle, now time.Time) {
+	ended := now
+	switch expiry := order.Expiry(); {
+	case !expiry.After(now):
+		order.State = orderbookfetcher.OrderExpired
+		ended = expiry
+	case len(order.Volumes) == 1:
+		order.State = orderbookfetcher.OrderCancelled
+	case order.Volumes[len(order.Volumes)-1].VolumeRemain <= largestTrade(order):
+		order.State = orderbookfetcher.OrderFilled
+	default:
+		order.State = orderbookfetcher.OrderGone
+	}
+	order.Ended = &ended
+}
+
+// the biggest drop of the remaining volume between two snapshots
+func largestTrade(order *orderbookfetcher.OrderLifecycle) int32 {
+	var largest int32
+	for i := 1; i < len(order.Volumes); i++ {
+		if traded := order.Volumes[i-1].VolumeRemain - order.Volumes[i].VolumeRemain; traded > largest {
+			largest = traded
+		}
+	}
+	return largest
+}
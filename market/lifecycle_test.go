@@ -0,0 +1,134 @@
+package market
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+const testLocation = 10000002
+
+func testSnapshot(date time.Time, orders ...*orderbookfetcher.MarketOrder) *orderbookfetcher.Snapshot {
+	return &orderbookfetcher.Snapshot{
+		Info:   &orderbookfetcher.OrderbookInfo{LocationID: testLocation, Date: date},
+		Orders: orders,
+	}
+}
+
+func testOrder(id int64, issued time.Time, volumeRemain int32) *orderbookfetcher.MarketOrder {
+	return &orderbookfetcher.MarketOrder{
+		OrderID:      id,
+		TypeID:       34,
+		LocationID:   60003760,
+		Issued:       issued,
+		Duration:     90,
+		Price:        5,
+		VolumeRemain: volumeRemain,
+		VolumeTotal:  100,
+	}
+}
+
+// the finished orders by id
+func readFinished(t *testing.T, dir string, date time.Time) map[int64]*orderbookfetcher.OrderLifecycle {
+	t.Helper()
+	file, err := os.Open(filepath.Join(dir, "10000002", "finished", date.UTC().Format("2006-01-02")+".ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	finished := make(map[int64]*orderbookfetcher.OrderLifecycle)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var order *orderbookfetcher.OrderLifecycle
+		if err := json.Unmarshal(scanner.Bytes(), &order); err != nil {
+			t.Fatal(err)
+		}
+		finished[order.OrderID] = order
+	}
+	return finished
+}
+
+func TestLifecycleEndStates(t *testing.T) {
+	dir := t.TempDir()
+	tracker := NewLifecycleTracker(dir)
+	start := time.Date(2023, 1, 10, 12, 0, 0, 0, time.UTC)
+	step := 5 * time.Minute
+
+	snapshots := []*orderbookfetcher.Snapshot{
+		testSnapshot(start,
+			// disappears without a trade
+			testOrder(1, start.Add(-time.Hour), 100),
+			// traded, what's left is bought up
+			testOrder(2, start.Add(-time.Hour), 100),
+			// runs out
+			testOrder(3, start.AddDate(0, 0, -90).Add(step), 100),
+			// partially traded, then the rest disappears
+			testOrder(4, start.Add(-time.Hour), 100),
+		),
+		testSnapshot(start.Add(step),
+			testOrder(2, start.Add(-time.Hour), 40),
+			testOrder(4, start.Add(-time.Hour), 90),
+		),
+		testSnapshot(start.Add(2 * step)),
+	}
+	for _, snapshot := range snapshots {
+		if err := tracker.HandleSnapshot(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	finished := readFinished(t, dir, start)
+	for _, test := range []struct {
+		id    int64
+		state orderbookfetcher.OrderState
+		ended time.Time
+	}{
+		{id: 1, state: orderbookfetcher.OrderCancelled, ended: start.Add(step)},
+		{id: 2, state: orderbookfetcher.OrderFilled, ended: start.Add(2 * step)},
+		{id: 3, state: orderbookfetcher.OrderExpired, ended: start.Add(step)},
+		{id: 4, state: orderbookfetcher.OrderGone, ended: start.Add(2 * step)},
+	} {
+		order, ok := finished[test.id]
+		if !ok {
+			t.Errorf("order %d hasn't finished", test.id)
+			continue
+		}
+		if order.State != test.state {
+			t.Errorf("order %d: expected %s, got %s", test.id, test.state, order.State)
+		}
+		if order.Ended == nil || !order.Ended.Equal(test.ended) {
+			t.Errorf("order %d: expected it to end at %s, got %v", test.id, test.ended, order.Ended)
+		}
+	}
+
+	// only the trades we have seen count towards the volume
+	traded := tracker.locations[testLocation].Traded[tradedKey(60003760, 34)][start.Format("2006-01-02")]
+	if traded != 70 {
+		t.Errorf("expected 70 to be traded, got %d", traded)
+	}
+}
+
+func TestLifecycleNoTradeCancelled(t *testing.T) {
+	tracker := NewLifecycleTracker(t.TempDir())
+	start := time.Date(2023, 1, 10, 12, 0, 0, 0, time.UTC)
+	order := testOrder(1, start.Add(-time.Hour), 100)
+	if err := tracker.HandleSnapshot(testSnapshot(start, order)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.HandleSnapshot(testSnapshot(start.Add(5 * time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+
+	finished := readFinished(t, tracker.dir, start)
+	if state := finished[1].State; state != orderbookfetcher.OrderCancelled {
+		t.Errorf("expected an order that vanished without a trade to be cancelled, got %s", state)
+	}
+	if traded := tracker.locations[testLocation].Traded; len(traded) != 0 {
+		t.Errorf("expected nothing to be traded, got %v", traded)
+	}
+}
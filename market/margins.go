@@ -0,0 +1,143 @@
+package market
+
+import (
+	"sort"
+	"sync"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// assure interface compliance
+var _ orderbookfetcher.SnapshotHandler = (*MarginCalculator)(nil)
+var _ orderbookfetcher.MarginService = (*MarginCalculator)(nil)
+var _ orderbookfetcher.EventHandler = (*MarginCalculator)(nil)
+var _ VolumeEstimator = (*LifecycleTracker)(nil)
+
+// infers how much of a type is traded per day
+type VolumeEstimator interface {
+	DailyVolume(location uint64, station int64, typeID int32) (float64, bool)
+}
+
+// calculates the station trading margins of every location after each snapshot
+type MarginCalculator struct {
+	mu sync.RWMutex
+
+	fees   orderbookfetcher.Fees
+	config orderbookfetcher.StationTradingConfig
+	// optional, used to add the daily volume to the trades
+	volumes VolumeEstimator
+
+	// latest report per location
+	reports map[uint64]*orderbookfetcher.MarginReport
+}
+
+// spread and competition of a type at a station
+type stationSpread struct {
+	trade *orderbookfetcher.StationTrade
+	// have we seen orders on both sides?
+	hasBuy, hasSell bool
+}
+
+type stationType struct {
+	station int64
+	typeID  int32
+}
+
+// construct a new calculator, volumes may be nil
+func NewMarginCalculator(fees orderbookfetcher.Fees, config orderbookfetcher.StationTradingConfig, volumes VolumeEstimator) *MarginCalculator {
+	return &MarginCalculator{
+		fees:    fees,
+		config:  config,
+		volumes: volumes,
+		reports: make(map[uint64]*orderbookfetcher.MarginReport),
+	}
+}
+
+// calculate the margins of every type at every station of the snapshot
+func (c *MarginCalculator) HandleSnapshot(snapshot *orderbookfetcher.Snapshot) error {
+	spreads := make(map[stationType]*stationSpread)
+
+	// find the best prices first
+	for _, order := range snapshot.Orders {
+		key := stationType{station: order.LocationID, typeID: order.TypeID}
+		spread, ok := spreads[key]
+		if !ok {
+			spread = &stationSpread{trade: &orderbookfetcher.StationTrade{TypeID: order.TypeID, StationID: order.LocationID}}
+			spreads[key] = spread
+		}
+		price := float64(order.Price)
+		if order.IsBuyOrder && (!spread.hasBuy || price > spread.trade.BestBuy) {
+			spread.trade.BestBuy, spread.hasBuy = price, true
+		} else if !order.IsBuyOrder && (!spread.hasSell || price < spread.trade.BestSell) {
+			spread.trade.BestSell, spread.hasSell = price, true
+		}
+	}
+
+	// then count the orders that are close to them
+	for _, order := range snapshot.Orders {
+		trade := spreads[stationType{station: order.LocationID, typeID: order.TypeID}].trade
+		price := float64(order.Price)
+		if order.IsBuyOrder && price >= trade.BestBuy*(1-c.config.CompetitionBand) {
+			trade.BuyCompetitors++
+			if order.Issued.After(trade.BuyUpdated) {
+				trade.BuyUpdated = order.Issued
+			}
+		} else if !order.IsBuyOrder && price <= trade.BestSell*(1+c.config.CompetitionBand) {
+			trade.SellCompetitors++
+			if order.Issued.After(trade.SellUpdated) {
+				trade.SellUpdated = order.Issued
+			}
+		}
+	}
+
+	report := &orderbookfetcher.MarginReport{
+		LocationID:   snapshot.Info.LocationID,
+		LocationName: snapshot.Info.LocationName,
+		Date:         snapshot.Info.Date,
+		Trades:       []*orderbookfetcher.StationTrade{},
+	}
+	for _, spread := range spreads {
+		if !spread.hasBuy || !spread.hasSell {
+			continue
+		}
+		trade := spread.trade
+		// we pay the broker fee on both orders and the sales tax on the sale
+		cost := trade.BestBuy * (1 + c.fees.BrokerFee)
+		revenue := trade.BestSell * (1 - c.fees.BrokerFee - c.fees.SalesTax)
+		trade.ProfitPerUnit = revenue - cost
+		trade.Margin = trade.ProfitPerUnit / cost
+		if trade.ProfitPerUnit <= 0 || trade.Margin < c.config.MinMargin {
+			continue
+		}
+		if c.volumes != nil {
+			if volume, ok := c.volumes.DailyVolume(snapshot.Info.LocationID, trade.StationID, trade.TypeID); ok {
+				trade.DailyVolume = &volume
+			}
+		}
+		report.Trades = append(report.Trades, trade)
+	}
+	sort.Slice(report.Trades, func(i, j int) bool { return report.Trades[i].Margin > report.Trades[j].Margin })
+
+	c.mu.Lock()
+	c.reports[snapshot.Info.LocationID] = report
+	c.mu.Unlock()
+	return nil
+}
+
+// the report of the latest snapshot of the location
+func (c *MarginCalculator) MarginReport(location uint64) (*orderbookfetcher.MarginReport, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	report, ok := c.reports[location]
+	return report, ok
+}
+
+// forget about the report of a location that isn't fetched anymore
+func (c *MarginCalculator) HandleEvent(event *orderbookfetcher.Event) {
+	if event.Type != orderbookfetcher.EventLocationRemoved {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.reports, event.LocationID)
+}
@@ -0,0 +1,34 @@
+package market
+
+import orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+
+// highest buy and lowest sell price per type
+func bestPrices(orders []*orderbookfetcher.MarketOrder) (bids map[int32]float64, asks map[int32]float64) {
+	bids = make(map[int32]float64)
+	asks = make(map[int32]float64)
+	for _, order := range orders {
+		price := float64(order.Price)
+		if order.IsBuyOrder {
+			if best, ok := bids[order.TypeID]; !ok || price > best {
+				bids[order.TypeID] = price
+			}
+		} else {
+			if best, ok := asks[order.TypeID]; !ok || price < best {
+				asks[order.TypeID] = price
+			}
+		}
+	}
+	return bids, asks
+}
+
+// every type id that appears in at least one of the price maps
+func types(bids, asks map[int32]float64) map[int32]struct{} {
+	ids := make(map[int32]struct{}, len(bids)+len(asks))
+	for typeID := range bids {
+		ids[typeID] = struct{}{}
+	}
+	for typeID := range asks {
+		ids[typeID] = struct{}{}
+	}
+	return ids
+}
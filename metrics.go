@@ -0,0 +1,46 @@
+package orderbookfetcher
+
+import "time"
+
+// counters and gauges of a single location
+type LocationMetrics struct {
+	LocationID   uint64
+	LocationName string
+	IsCitadel    bool
+
+	// how many orderbooks have been written, and how long fetching them took in total
+	Fetches       uint
+	FetchDuration time.Duration
+	// how long the last fetch took and how many pages it had
+	LastFetchDuration time.Duration
+	LastPages         uint
+	// pages fetched in total
+	Pages uint
+	// requests for an order page that had to be repeated
+	Retries uint
+	// fetches that have been skipped because of the interval
+	Skipped uint
+	// failed fetches
+	Failures uint
+
+	// the last orderbook written, nil if there is none yet
+	LastOrderbook *OrderbookInfo
+	// when does the esi data expire next?
+	NextExpiry time.Time
+	// size of the orderbooks of the location that are currently on disk
+	DiskBytes int64
+}
+
+// what the fetcher has been doing since it started
+type FetcherMetrics struct {
+	// esi responses by status code
+	Responses map[int]uint
+	// esi requests that didn't get a response at all
+	RequestErrors uint
+	// the last value of the X-Esi-Error-Limit-Remain header, -1 if we haven't seen one yet
+	ErrorLimitRemain int
+	// how often refreshing the access token succeeded or failed
+	TokenRefreshes       uint
+	TokenRefreshFailures uint
+	Locations            []*LocationMetrics
+}
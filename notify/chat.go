@@ -0,0 +1,255 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// assure interface compliance
+var _ orderbookfetcher.EventHandler = (*Chat)(nil)
+var _ orderbookfetcher.Notifier = (*Chat)(nil)
+
+// the most a single post can hold
+const (
+	discordMaxLength = 2000
+	slackMaxLength   = 40000
+)
+
+// posts failures and alerts to a discord or slack channel.
+// repeats of the same failure are only reported once per dedupe window,
+// and messages arriving faster than the minimum interval are batched into the next post
+type Chat struct {
+	mu sync.Mutex
+
+	client *http.Client
+	config orderbookfetcher.ChatConfig
+	// discord or slack
+	format string
+
+	// when did we last send a message?
+	lastSent time.Time
+	// messages waiting for the minimum interval to pass, the first one is scheduled
+	queue []*batch
+	// when did we last deliver a failure/alert, by dedupe key
+	reported map[string]time.Time
+	// the batches of the messages that haven't been delivered yet, by dedupe key
+	pending map[string]*batch
+}
+
+// messages that go out in a single post
+type batch struct {
+	messages []string
+	// dedupe keys of the messages
+	keys   []string
+	length int
+	// closed once the post has been sent, err tells if it succeeded
+	done chan struct{}
+	err  error
+}
+
+// construct a new chat notifier for the channel
+func NewChat(config orderbookfetcher.ChatConfig) *Chat {
+	format := strings.ToLower(config.Format)
+	if format == "" {
+		format = "slack"
+		if strings.Contains(config.URL, "discord") {
+			format = "discord"
+		}
+	}
+	return &Chat{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		config:   config,
+		format:   format,
+		reported: make(map[string]time.Time),
+		pending:  make(map[string]*batch),
+	}
+}
+
+// report failures, everything else is ignored
+func (c *Chat) HandleEvent(event *orderbookfetcher.Event) {
+	var title string
+	switch event.Type {
+	case orderbookfetcher.EventFetchFailed:
+		title = "Fetch failed"
+	case orderbookfetcher.EventTokenRefreshFailed:
+		title = "Token refresh failed"
+	default:
+		return
+	}
+
+	lines := []string{c.bold(title)}
+	if event.LocationID != 0 {
+		lines = append(lines, fmt.Sprintf("Location: %s (%d)", event.LocationName, event.LocationID))
+	}
+	lines = append(lines, "Error: "+c.code(event.Error))
+	if event.LastSnapshot != nil {
+		lines = append(lines, fmt.Sprintf("Last successful snapshot: %s (%s ago)",
+			event.LastSnapshot.UTC().Format(time.RFC1123),
+			time.Since(*event.LastSnapshot).Round(time.Second),
+		))
+	} else if event.LocationID != 0 {
+		lines = append(lines, "Last successful snapshot: none")
+	}
+
+	// a flapping location keeps failing with slightly different errors,
+	// so only the type and location are used to spot repeats
+	// the fetcher isn't held up, the message goes out with the next post
+	key := fmt.Sprintf("%s/%d", event.Type, event.LocationID)
+	c.admit(key, strings.Join(lines, "\n"))
+}
+
+// post an alert to the channel, waits until the post with the alert has been sent
+func (c *Chat) Notify(alert *orderbookfetcher.Alert) error {
+	key := fmt.Sprintf("%s/%d/%d/%d/%v/%f", alert.Kind, alert.LocationID, alert.TypeID, alert.OrderID, alert.IsBuyOrder, alert.OtherPrice)
+	b := c.admit(key, c.bold("Alert")+"\n"+alert.Message)
+	if b == nil {
+		// already reported within the dedupe window
+		return nil
+	}
+	<-b.done
+	return b.err
+}
+
+// apply deduplication and queue the message for the next post,
+// returns the batch it is sent with or nil for a repeat.
+// a message only counts as reported once it has been delivered, until then repeats wait for the same post
+func (c *Chat) admit(key, message string) *batch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+
+	if b, ok := c.pending[key]; ok {
+		return b
+	}
+	if last, ok := c.reported[key]; ok && now.Sub(last) < time.Duration(c.config.DedupeWindow) {
+		return nil
+	}
+	// forget about keys that have left the window
+	for k, last := range c.reported {
+		if now.Sub(last) >= time.Duration(c.config.DedupeWindow) {
+			delete(c.reported, k)
+		}
+	}
+
+	// a single message can't be longer than a post
+	message = truncate(message, c.maxLength())
+	// start a new post if the last one is full
+	n := len(c.queue)
+	if n == 0 || c.queue[n-1].length+len(message)+2 > c.maxLength() {
+		c.queue = append(c.queue, &batch{done: make(chan struct{})})
+		if n == 0 {
+			c.schedule()
+		}
+	}
+	b := c.queue[len(c.queue)-1]
+	b.messages = append(b.messages, message)
+	b.keys = append(b.keys, key)
+	b.length += len(message) + 2
+	c.pending[key] = b
+	return b
+}
+
+// flush the first batch once the minimum interval has passed, c.mu has to be held
+func (c *Chat) schedule() {
+	delay := time.Until(c.lastSent.Add(time.Duration(c.config.MinInterval)))
+	if delay < 0 {
+		delay = 0
+	}
+	time.AfterFunc(delay, c.flush)
+}
+
+// send the first batch and schedule the next one
+func (c *Chat) flush() {
+	c.mu.Lock()
+	b := c.queue[0]
+	c.queue = c.queue[1:]
+	c.lastSent = time.Now()
+	if len(c.queue) > 0 {
+		c.schedule()
+	}
+	c.mu.Unlock()
+
+	b.err = c.send(strings.Join(b.messages, "\n\n"))
+	if b.err != nil {
+		log.Printf("failed to post chat message: %s", b.err)
+	}
+	c.mu.Lock()
+	for _, key := range b.keys {
+		delete(c.pending, key)
+		// a failed post doesn't keep the next one from being reported
+		if b.err == nil {
+			c.reported[key] = time.Now()
+		}
+	}
+	c.mu.Unlock()
+	close(b.done)
+}
+
+// how long a post can get
+func (c *Chat) maxLength() int {
+	if c.format == "discord" {
+		return discordMaxLength
+	}
+	return slackMaxLength
+}
+
+// cut the message off at max bytes, without splitting a character
+func truncate(message string, max int) string {
+	if len(message) <= max {
+		return message
+	}
+	const ellipsis = "…"
+	cut := max - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+	return message[:cut] + ellipsis
+}
+
+// post the message to the channel
+func (c *Chat) send(message string) error {
+	var body any = struct {
+		Text string `json:"text"`
+	}{Text: message}
+	if c.format == "discord" {
+		body = struct {
+			Content string `json:"content"`
+		}{Content: message}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Post(c.config.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("chat webhook returned status code %s", resp.Status)
+	}
+	return nil
+}
+
+// bold text in the markup of the channel
+func (c *Chat) bold(s string) string {
+	if c.format == "discord" {
+		return "**" + s + "**"
+	}
+	return "*" + s + "*"
+}
+
+// inline code, the same for both
+func (c *Chat) code(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "'") + "`"
+}
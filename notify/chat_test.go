@@ -0,0 +1,277 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// a chat webhook that records the posts it receives
+type chatServer struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	posts []map[string]string
+	times []time.Time
+}
+
+func newChatServer(t *testing.T) *chatServer {
+	s := &chatServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode the post: %s", err)
+		}
+		s.mu.Lock()
+		s.posts = append(s.posts, body)
+		s.times = append(s.times, time.Now())
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// wait until n posts have arrived
+func (s *chatServer) wait(t *testing.T, n int) []map[string]string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		posts := append([]map[string]string(nil), s.posts...)
+		s.mu.Unlock()
+		if len(posts) >= n {
+			return posts
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d posts", n)
+	return nil
+}
+
+func newTestChat(url, format string, minInterval time.Duration) *Chat {
+	return NewChat(orderbookfetcher.ChatConfig{
+		URL:          url,
+		Format:       format,
+		MinInterval:  orderbookfetcher.Duration(minInterval),
+		DedupeWindow: orderbookfetcher.Duration(time.Hour),
+	})
+}
+
+func testAlert(order int64, message string) *orderbookfetcher.Alert {
+	return &orderbookfetcher.Alert{
+		Kind:       orderbookfetcher.AlertUndercut,
+		LocationID: 10000002,
+		TypeID:     34,
+		OrderID:    order,
+		Price:      5,
+		OtherPrice: 4.9,
+		Message:    message,
+	}
+}
+
+func TestChatPayloads(t *testing.T) {
+	for _, test := range []struct {
+		format, field, text string
+	}{
+		{format: "discord", field: "content", text: "**Alert**\nundercut"},
+		{format: "slack", field: "text", text: "*Alert*\nundercut"},
+	} {
+		server := newChatServer(t)
+		chat := newTestChat(server.URL, test.format, 0)
+		if err := chat.Notify(testAlert(1, "undercut")); err != nil {
+			t.Fatalf("%s: %s", test.format, err)
+		}
+		posts := server.wait(t, 1)
+		if len(posts[0]) != 1 || posts[0][test.field] != test.text {
+			t.Errorf("%s: unexpected payload %v", test.format, posts[0])
+		}
+	}
+}
+
+func TestChatGuessesFormat(t *testing.T) {
+	if chat := NewChat(orderbookfetcher.ChatConfig{URL: "https://discord.com/api/webhooks/1/x"}); chat.format != "discord" {
+		t.Errorf("expected discord, got %s", chat.format)
+	}
+	if chat := NewChat(orderbookfetcher.ChatConfig{URL: "https://hooks.slack.com/services/x"}); chat.format != "slack" {
+		t.Errorf("expected slack, got %s", chat.format)
+	}
+}
+
+func TestChatDedupe(t *testing.T) {
+	server := newChatServer(t)
+	chat := newTestChat(server.URL, "slack", 0)
+	failure := func(location uint64, err string) *orderbookfetcher.Event {
+		return &orderbookfetcher.Event{
+			Type:         orderbookfetcher.EventFetchFailed,
+			LocationID:   location,
+			LocationName: "The Forge",
+			Error:        err,
+		}
+	}
+
+	chat.HandleEvent(failure(10000002, "timeout"))
+	server.wait(t, 1)
+	// a different error of the same location is still a repeat
+	chat.HandleEvent(failure(10000002, "status 502"))
+	chat.HandleEvent(failure(10000043, "timeout"))
+	server.wait(t, 2)
+
+	// give a wrongly admitted repeat the time to arrive
+	time.Sleep(50 * time.Millisecond)
+	posts := server.wait(t, 2)
+	if len(posts) != 2 {
+		t.Fatalf("expected 2 posts, got %d", len(posts))
+	}
+	if !strings.Contains(posts[0]["text"], "(10000002)") || !strings.Contains(posts[1]["text"], "(10000043)") {
+		t.Errorf("unexpected posts %v", posts)
+	}
+	if strings.Contains(posts[1]["text"], "status 502") {
+		t.Errorf("the repeated failure has been posted: %v", posts)
+	}
+
+	// the same alert is only posted once, but alerts about a new price are
+	alert := testAlert(1, "undercut")
+	for _, message := range []string{"undercut", "undercut again"} {
+		alert.Message = message
+		if err := chat.Notify(alert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alert.OtherPrice, alert.Message = 4.8, "undercut further"
+	if err := chat.Notify(alert); err != nil {
+		t.Fatal(err)
+	}
+	posts = server.wait(t, 4)
+	if len(posts) != 4 || !strings.Contains(posts[2]["text"], "undercut") || !strings.Contains(posts[3]["text"], "undercut further") {
+		t.Errorf("unexpected alert posts %v", posts[2:])
+	}
+}
+
+func TestChatRateLimit(t *testing.T) {
+	server := newChatServer(t)
+	minInterval := 200 * time.Millisecond
+	chat := newTestChat(server.URL, "discord", minInterval)
+
+	if err := chat.Notify(testAlert(1, "first")); err != nil {
+		t.Fatal(err)
+	}
+	// both arrive within the interval and go out together
+	var wg sync.WaitGroup
+	for i, message := range []string{"second", "third"} {
+		wg.Add(1)
+		go func(order int64, message string) {
+			defer wg.Done()
+			if err := chat.Notify(testAlert(order, message)); err != nil {
+				t.Error(err)
+			}
+		}(int64(i+2), message)
+	}
+	wg.Wait()
+
+	posts := server.wait(t, 2)
+	if len(posts) != 2 {
+		t.Fatalf("expected 2 posts, got %d", len(posts))
+	}
+	if !strings.Contains(posts[0]["content"], "first") {
+		t.Errorf("unexpected first post %q", posts[0]["content"])
+	}
+	if !strings.Contains(posts[1]["content"], "second") || !strings.Contains(posts[1]["content"], "third") {
+		t.Errorf("the suppressed alerts are missing from the batch: %q", posts[1]["content"])
+	}
+	server.mu.Lock()
+	gap := server.times[1].Sub(server.times[0])
+	server.mu.Unlock()
+	if gap < minInterval-10*time.Millisecond {
+		t.Errorf("the batch has been sent after %s, expected at least %s", gap, minInterval)
+	}
+}
+
+func TestChatSplitsLongBatches(t *testing.T) {
+	server := newChatServer(t)
+	chat := newTestChat(server.URL, "discord", 50*time.Millisecond)
+
+	long := strings.Repeat("x", 1500)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(order int64) {
+			defer wg.Done()
+			if err := chat.Notify(testAlert(order, long)); err != nil {
+				t.Error(err)
+			}
+		}(int64(i + 1))
+	}
+	wg.Wait()
+
+	for _, post := range server.wait(t, 2) {
+		if len(post["content"]) > discordMaxLength {
+			t.Errorf("post is %d characters long", len(post["content"]))
+		}
+	}
+}
+
+func TestChatReportsFailedPosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	chat := newTestChat(server.URL, "slack", 0)
+	if err := chat.Notify(testAlert(1, "undercut")); err == nil {
+		t.Error("expected the failed post to be reported")
+	}
+}
+
+func TestChatRetriesFailedReports(t *testing.T) {
+	var mu sync.Mutex
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		posts++
+		if posts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	chat := newTestChat(server.URL, "slack", 0)
+
+	if err := chat.Notify(testAlert(1, "undercut")); err == nil {
+		t.Fatal("expected the first post to fail")
+	}
+	// the failed post doesn't count as reported, the delivered one does
+	for i := 0; i < 2; i++ {
+		if err := chat.Notify(testAlert(1, "undercut")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if posts != 2 {
+		t.Errorf("expected the alert to be posted again once, got %d posts", posts)
+	}
+}
+
+func TestChatTruncatesLongMessages(t *testing.T) {
+	server := newChatServer(t)
+	chat := newTestChat(server.URL, "discord", 0)
+	if err := chat.Notify(testAlert(1, strings.Repeat("ü", discordMaxLength))); err != nil {
+		t.Fatal(err)
+	}
+	content := server.wait(t, 1)[0]["content"]
+	if len(content) > discordMaxLength || !strings.HasSuffix(content, "…") {
+		t.Errorf("expected the message to be cut off at %d bytes, got %d", discordMaxLength, len(content))
+	}
+	if !utf8.ValidString(content) {
+		t.Error("a character has been split")
+	}
+}
@@ -0,0 +1,388 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// assure interface compliance
+var _ orderbookfetcher.EventHandler = (*WebhookDispatcher)(nil)
+var _ orderbookfetcher.Notifier = (*WebhookDispatcher)(nil)
+
+const (
+	// how often do we try to deliver an event before giving up?
+	maxAttempts = 10
+	// the backoff doubles with every failed attempt, up to maxBackoff
+	initialBackoff = 5 * time.Second
+	maxBackoff     = time.Hour
+
+	// sent as X-Orderbook-Event with the alerts
+	alertEvent orderbookfetcher.EventType = "alert"
+)
+
+// posts fetcher events and alerts to the configured webhooks.
+// every delivery is written to the outbox directory first and only removed once it succeeded,
+// so events that haven't been delivered yet survive a restart
+type WebhookDispatcher struct {
+	mu sync.Mutex
+
+	client *http.Client
+	// cancellation function to stop the delivery goroutine
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// woken up whenever a new delivery gets queued
+	wake chan struct{}
+
+	// where the pending deliveries are stored
+	outbox string
+	// prepended to the orderbook file names to build download links,
+	// the server finds the files in the directories of their locations
+	publicURL string
+	hooks     []orderbookfetcher.WebhookConfig
+	// where the alerts are posted to
+	alertHooks []string
+
+	// deliveries that haven't succeeded yet
+	pending []*delivery
+}
+
+// an event on its way to a single webhook
+type delivery struct {
+	ID      string                     `json:"id"`
+	URL     string                     `json:"url"`
+	Event   orderbookfetcher.EventType `json:"event"`
+	Payload json.RawMessage            `json:"payload"`
+	// how often have we tried to deliver it?
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+}
+
+// the body that gets posted to the webhooks
+type payload struct {
+	ID string `json:"id"`
+	*orderbookfetcher.Event
+	// where the orderbook can be downloaded, only set for committed snapshots
+	URL string `json:"url,omitempty"`
+}
+
+// the body that gets posted for an alert
+type alertPayload struct {
+	ID string `json:"id"`
+	*orderbookfetcher.Alert
+}
+
+// construct a new dispatcher that keeps its pending deliveries in outbox
+func NewWebhookDispatcher(outbox, publicURL string, hooks []orderbookfetcher.WebhookConfig, alertHooks []string) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		wake:       make(chan struct{}, 1),
+		outbox:     outbox,
+		publicURL:  strings.TrimSuffix(publicURL, "/"),
+		hooks:      hooks,
+		alertHooks: alertHooks,
+	}
+}
+
+// load the deliveries left over from the last run and start delivering
+func (d *WebhookDispatcher) Start() error {
+	if err := os.MkdirAll(d.outbox, 0755); err != nil {
+		return err
+	}
+	if err := d.loadOutbox(); err != nil {
+		return err
+	}
+
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(context.Background())
+	d.wg.Add(1)
+	go func() {
+		d.deliver(ctx)
+		d.wg.Done()
+	}()
+	return nil
+}
+
+// stop delivering, whatever is still pending stays in the outbox
+func (d *WebhookDispatcher) Shutdown() {
+	if d.cancel == nil {
+		return
+	}
+	d.cancel()
+	d.wg.Wait()
+}
+
+// queue the event for every webhook that is interested in it
+func (d *WebhookDispatcher) HandleEvent(event *orderbookfetcher.Event) {
+	id := newID()
+	p := payload{ID: id, Event: event}
+	if event.FileName != "" {
+		p.URL = d.publicURL + "/orderbooks/" + path.Base(filepath.ToSlash(event.FileName))
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("failed to encode event: %s", err)
+		return
+	}
+
+	var urls []string
+	for _, hook := range d.hooks {
+		if subscribed(hook, event.Type) {
+			urls = append(urls, hook.URL)
+		}
+	}
+	if err := d.queue(id, event.Type, body, urls); err != nil {
+		log.Printf("failed to write delivery to the outbox: %s", err)
+	}
+}
+
+// queue the alert for the alert webhooks,
+// it counts as sent once it is in the outbox
+func (d *WebhookDispatcher) Notify(alert *orderbookfetcher.Alert) error {
+	id := newID()
+	body, err := json.Marshal(alertPayload{ID: id, Alert: alert})
+	if err != nil {
+		return err
+	}
+	return d.queue(id, alertEvent, body, d.alertHooks)
+}
+
+// add a delivery of the payload to every url and wake up the delivery goroutine.
+// the deliveries are queued even if they can't be written to the outbox, the error is returned anyway
+func (d *WebhookDispatcher) queue(id string, eventType orderbookfetcher.EventType, body []byte, urls []string) error {
+	var saveErr error
+	d.mu.Lock()
+	for i, url := range urls {
+		delivery := &delivery{
+			ID:          fmt.Sprintf("%s-%d", id, i),
+			URL:         url,
+			Event:       eventType,
+			Payload:     body,
+			NextAttempt: time.Now(),
+		}
+		if err := d.save(delivery); err != nil && saveErr == nil {
+			saveErr = err
+		}
+		d.pending = append(d.pending, delivery)
+	}
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return saveErr
+}
+
+// deliver whatever is due until the context is cancelled
+func (d *WebhookDispatcher) deliver(ctx context.Context) {
+	for {
+		d.mu.Lock()
+		var due []*delivery
+		next := time.Now().Add(maxBackoff)
+		for _, delivery := range d.pending {
+			if !delivery.NextAttempt.After(time.Now()) {
+				due = append(due, delivery)
+			} else if delivery.NextAttempt.Before(next) {
+				next = delivery.NextAttempt
+			}
+		}
+		d.mu.Unlock()
+
+		for _, delivery := range due {
+			if ctx.Err() != nil {
+				return
+			}
+			d.attempt(delivery)
+		}
+		if len(due) > 0 {
+			// the attempts have moved the schedule
+			continue
+		}
+
+		select {
+		case <-time.After(time.Until(next)):
+		case <-d.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// try to deliver once, reschedule or drop it if that fails
+func (d *WebhookDispatcher) attempt(delivery *delivery) {
+	err := d.post(delivery)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery.Attempts++
+	if err == nil || delivery.Attempts >= maxAttempts {
+		if err != nil {
+			log.Printf("giving up on delivering %s to %s after %d attempts: %s", delivery.Event, delivery.URL, delivery.Attempts, err)
+		}
+		d.remove(delivery)
+		return
+	}
+
+	backoff := initialBackoff << (delivery.Attempts - 1)
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	delivery.NextAttempt = time.Now().Add(backoff)
+	log.Printf("failed to deliver %s to %s, retrying in %s: %s", delivery.Event, delivery.URL, backoff, err)
+	if err := d.save(delivery); err != nil {
+		log.Printf("failed to update delivery in the outbox: %s", err)
+	}
+}
+
+// post the payload to the webhook, signed with its secret
+func (d *WebhookDispatcher) post(delivery *delivery) error {
+	hook, ok := d.hook(delivery.URL)
+	if !ok {
+		// the webhook has been removed from the configuration since
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Orderbook-Event", string(delivery.Event))
+	req.Header.Set("X-Orderbook-Delivery", delivery.ID)
+	if hook.Secret != "" {
+		req.Header.Set("X-Orderbook-Signature", Sign(hook.Secret, delivery.Payload))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status code %s", resp.Status)
+	}
+	return nil
+}
+
+// signature of the payload, as sent in the X-Orderbook-Signature header
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// look up the configuration of a webhook
+func (d *WebhookDispatcher) hook(url string) (orderbookfetcher.WebhookConfig, bool) {
+	for _, hook := range d.hooks {
+		if hook.URL == url {
+			return hook, true
+		}
+	}
+	for _, hook := range d.alertHooks {
+		if hook == url {
+			return orderbookfetcher.WebhookConfig{URL: url}, true
+		}
+	}
+	return orderbookfetcher.WebhookConfig{}, false
+}
+
+// read the pending deliveries from the outbox, oldest first
+func (d *WebhookDispatcher) loadOutbox() error {
+	entries, err := os.ReadDir(d.outbox)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		file, err := os.Open(filepath.Join(d.outbox, entry.Name()))
+		if err != nil {
+			return err
+		}
+		var delivery *delivery
+		err = json.NewDecoder(file).Decode(&delivery)
+		file.Close()
+		if err != nil {
+			log.Printf("dropping unreadable delivery %s: %s", entry.Name(), err)
+			os.Remove(filepath.Join(d.outbox, entry.Name()))
+			continue
+		}
+		d.pending = append(d.pending, delivery)
+	}
+	sort.Slice(d.pending, func(i, j int) bool { return d.pending[i].NextAttempt.Before(d.pending[j].NextAttempt) })
+	if len(d.pending) > 0 {
+		log.Printf("loaded %d pending webhook deliveries", len(d.pending))
+	}
+	return nil
+}
+
+// write the delivery to the outbox
+func (d *WebhookDispatcher) save(delivery *delivery) error {
+	fileName := filepath.Join(d.outbox, delivery.ID+".json")
+	file, err := os.Create(fileName + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(file).Encode(delivery); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), fileName)
+}
+
+// drop the delivery from the queue and the outbox, d.mu has to be held
+func (d *WebhookDispatcher) remove(delivery *delivery) {
+	for i, pending := range d.pending {
+		if pending == delivery {
+			d.pending = append(d.pending[:i], d.pending[i+1:]...)
+			break
+		}
+	}
+	if err := os.Remove(filepath.Join(d.outbox, delivery.ID+".json")); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to remove delivery from the outbox: %s", err)
+	}
+}
+
+// is the webhook interested in this event?
+func subscribed(hook orderbookfetcher.WebhookConfig, eventType orderbookfetcher.EventType) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, t := range hook.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// random id for events and deliveries
+func newID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		// fall back to the time, we only need the ids to be unique
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
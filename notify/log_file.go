@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// assure interface compliance
+var _ orderbookfetcher.Notifier = (*LogFile)(nil)
+
+// appends alerts to a local file, one line per alert
+type LogFile struct {
+	mu       sync.Mutex
+	fileName string
+}
+
+// construct a new notifier that appends to fileName
+func NewLogFile(fileName string) *LogFile {
+	return &LogFile{fileName: fileName}
+}
+
+func (l *LogFile) Notify(alert *orderbookfetcher.Alert) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	file, err := os.OpenFile(l.fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(file, "%s [%s] %s\n", time.Now().UTC().Format(time.RFC3339), alert.Kind, alert.Message); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
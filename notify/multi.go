@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	orderbookfetcher "github.com/SustainedCruelty/eve-orderbook-fetcher"
+)
+
+// assure interface compliance
+var _ orderbookfetcher.Notifier = (Multi)(nil)
+
+// passes every alert on to all of its notifiers
+type Multi []orderbookfetcher.Notifier
+
+// notify every notifier at once, even if some of them fail.
+// the alert counts as sent once any of them delivered it, the others are only logged
+// so the ones that work don't get the same alert again
+func (m Multi) Notify(alert *orderbookfetcher.Alert) error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var errs []string
+	for _, notifier := range m {
+		wg.Add(1)
+		go func(notifier orderbookfetcher.Notifier) {
+			defer wg.Done()
+			if err := notifier.Notify(alert); err != nil {
+				mu.Lock()
+				errs = append(errs, err.Error())
+				mu.Unlock()
+			}
+		}(notifier)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("%d notifier(s) failed: %s", len(errs), strings.Join(errs, "; "))
+	if len(errs) < len(m) {
+		log.Printf("failed to send alert: %s", err)
+		return nil
+	}
+	return err
+}
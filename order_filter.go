@@ -0,0 +1,41 @@
+package orderbookfetcher
+
+// narrows down the orders of a snapshot, zero values match everything
+type OrderFilter struct {
+	// only these types
+	TypeIDs map[int32]struct{}
+	// only buy (true) or sell (false) orders
+	IsBuyOrder *bool
+	// only orders at this station/structure
+	StationID int64
+	// only orders in this solar system
+	SystemID int32
+	// price range, zero means unbounded
+	MinPrice float64
+	MaxPrice float64
+	// minimum remaining volume
+	MinVolume int32
+}
+
+// does the order pass every filter?
+func (f *OrderFilter) Match(order *MarketOrder) bool {
+	if len(f.TypeIDs) > 0 {
+		if _, ok := f.TypeIDs[order.TypeID]; !ok {
+			return false
+		}
+	}
+	if f.IsBuyOrder != nil && *f.IsBuyOrder != order.IsBuyOrder {
+		return false
+	}
+	if f.StationID != 0 && f.StationID != order.LocationID {
+		return false
+	}
+	if f.SystemID != 0 && f.SystemID != order.SystemID {
+		return false
+	}
+	price := float64(order.Price)
+	if (f.MinPrice != 0 && price < f.MinPrice) || (f.MaxPrice != 0 && price > f.MaxPrice) {
+		return false
+	}
+	return order.VolumeRemain >= f.MinVolume
+}
@@ -0,0 +1,66 @@
+package orderbookfetcher
+
+import "time"
+
+// state of an order, as far as we can tell from the snapshots.
+// fills and cancellations can't be observed directly, an order that disappears before it expires
+// with volume left is told apart by the trades we have seen on it
+type OrderState string
+
+const (
+	// still on the market
+	OrderOpen OrderState = "open"
+	// disappeared after Issued + Duration
+	OrderExpired OrderState = "expired"
+	// disappeared without any trade being seen,
+	// a single trade taking all of it in between two snapshots is counted as a cancellation
+	OrderCancelled OrderState = "cancelled"
+	// disappeared after trades had been seen and what was left was no more than the biggest of them,
+	// so it was most likely bought up
+	OrderFilled OrderState = "filled"
+	// disappeared after trades had been seen with more left than any of them,
+	// the rest was either cancelled or filled by a bigger trade
+	OrderGone OrderState = "gone"
+)
+
+// price of an order at the time of a snapshot
+type PricePoint struct {
+	Time  time.Time `json:"time"`
+	Price float32   `json:"price"`
+}
+
+// remaining volume of an order at the time of a snapshot
+type VolumePoint struct {
+	Time         time.Time `json:"time"`
+	VolumeRemain int32     `json:"volumeRemain"`
+}
+
+// history of a single order across the snapshots of a location
+type OrderLifecycle struct {
+	OrderID    int64     `json:"orderId"`
+	TypeID     int32     `json:"typeId"`
+	LocationID int64     `json:"locationId"`
+	SystemID   int32     `json:"systemId"`
+	IsBuyOrder bool      `json:"isBuyOrder"`
+	Issued     time.Time `json:"issued"`
+	// in days
+	Duration    int32 `json:"duration"`
+	VolumeTotal int32 `json:"volumeTotal"`
+
+	// first and last snapshot the order appeared in
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	// the initial price and every change after that
+	Prices []PricePoint `json:"prices"`
+	// the initial remaining volume and every change after that
+	Volumes []VolumePoint `json:"volumes"`
+
+	State OrderState `json:"state"`
+	// when did the order disappear, nil while it is open
+	Ended *time.Time `json:"ended,omitempty"`
+}
+
+// when does the order run out?
+func (o *OrderLifecycle) Expiry() time.Time {
+	return o.Issued.Add(time.Duration(o.Duration) * 24 * time.Hour)
+}
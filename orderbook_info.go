@@ -4,19 +4,19 @@ import "time"
 
 type OrderbookInfo struct {
 	// how many orders does this orderbook contain?
-	OrderCount uint
+	OrderCount uint `json:"orderCount"`
 	// how many of those orders are sell orders?
-	SellOrderCount uint
+	SellOrderCount uint `json:"sellOrderCount"`
 	// how many are buy orders
-	BuyOrderCount uint
+	BuyOrderCount uint `json:"buyOrderCount"`
 	// name of the location that we fetched the orders for
-	LocationName string
+	LocationName string `json:"locationName"`
 	// location id
-	LocationID uint64
+	LocationID uint64 `json:"locationId"`
 	// did we fetch those orders from a citadel
-	IsCitadel bool
+	IsCitadel bool `json:"isCitadel"`
 	// when did/does this data expire
-	Date time.Time
+	Date time.Time `json:"date"`
 }
 
 // construct a new instance of the OrderbookInfo
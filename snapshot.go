@@ -0,0 +1,172 @@
+package orderbookfetcher
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// column names of the orderbook csv files
+const CSVHeader = "ORDERID,TYPEID,SYSTEMID,LOCATIONID,PRICE,RANGE,ISBUY,ISSUED,DURATION,MINVOLUME,VOLUMEREMAIN,VOLUMETOTAL"
+
+// an orderbook that has been written to disk
+type Snapshot struct {
+	// path of the csv file
+	FileName string
+	// stats about the orderbook
+	Info *OrderbookInfo
+	// every order contained in the file
+	Orders []*MarketOrder
+}
+
+// gets called by the fetcher after an orderbook has been written to disk
+type SnapshotHandler interface {
+	HandleSnapshot(snapshot *Snapshot) error
+}
+
+// open an orderbook file for reading, gzipped files (.csv.gz) are decompressed
+func OpenOrderbook(fileName string) (io.ReadCloser, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(fileName, ".gz") {
+		return file, nil
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return &gzipFile{Reader: gz, file: file}, nil
+}
+
+// closes the gzip reader and the file underneath
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (f *gzipFile) Close() error {
+	f.Reader.Close()
+	return f.file.Close()
+}
+
+// read every order from an orderbook file into a snapshot
+func LoadSnapshot(fileName string, info *OrderbookInfo) (*Snapshot, error) {
+	file, err := OpenOrderbook(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	snapshot := &Snapshot{
+		FileName: fileName,
+		Info:     info,
+		Orders:   make([]*MarketOrder, 0, info.OrderCount),
+	}
+	reader := NewOrderReader(file)
+	for {
+		order, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", fileName, err)
+		}
+		snapshot.Orders = append(snapshot.Orders, order)
+	}
+	return snapshot, nil
+}
+
+// extract the location and expiry from an orderbook file name ({location}_{expiry}.csv or .csv.gz)
+func ParseOrderbookFileName(fileName string) (location uint64, expiry time.Time, err error) {
+	base := filepath.Base(fileName)
+	name := strings.TrimSuffix(base, ".gz")
+	if !strings.HasSuffix(name, ".csv") {
+		return 0, time.Time{}, fmt.Errorf("not an orderbook file: %s", base)
+	}
+	parts := strings.Split(strings.TrimSuffix(name, ".csv"), "_")
+	if len(parts) != 2 {
+		return 0, time.Time{}, fmt.Errorf("not an orderbook file: %s", base)
+	}
+	if location, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return 0, time.Time{}, fmt.Errorf("not an orderbook file: %s", base)
+	}
+	unix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("not an orderbook file: %s", base)
+	}
+	return location, time.Unix(unix, 0).UTC(), nil
+}
+
+// reads MarketOrders one by one from an orderbook csv file
+type OrderReader struct {
+	reader *csv.Reader
+	// did we already skip the column names?
+	header bool
+}
+
+// construct a new reader, the csv header is skipped automatically
+func NewOrderReader(r io.Reader) *OrderReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 12
+	reader.ReuseRecord = true
+	return &OrderReader{reader: reader}
+}
+
+// read the next order, returns io.EOF once the file has been read completely
+func (r *OrderReader) Read() (*MarketOrder, error) {
+	if !r.header {
+		if _, err := r.reader.Read(); err != nil {
+			return nil, err
+		}
+		r.header = true
+	}
+	record, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	return parseOrderRecord(record)
+}
+
+// parse a single csv row, columns are in the order of CSVHeader
+func parseOrderRecord(record []string) (*MarketOrder, error) {
+	var err error
+	order := &MarketOrder{Range: record[5]}
+	// collect the first parsing error instead of checking every column
+	parseInt := func(s string, bits int) int64 {
+		v, e := strconv.ParseInt(s, 10, bits)
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	}
+	order.OrderID = parseInt(record[0], 64)
+	order.TypeID = int32(parseInt(record[1], 32))
+	order.SystemID = int32(parseInt(record[2], 32))
+	order.LocationID = parseInt(record[3], 64)
+	price, e := strconv.ParseFloat(record[4], 32)
+	if e != nil && err == nil {
+		err = e
+	}
+	order.Price = float32(price)
+	order.IsBuyOrder, e = strconv.ParseBool(record[6])
+	if e != nil && err == nil {
+		err = e
+	}
+	order.Issued = time.Unix(parseInt(record[7], 64), 0).UTC()
+	order.Duration = int32(parseInt(record[8], 32))
+	order.MinVolume = int32(parseInt(record[9], 32))
+	order.VolumeRemain = int32(parseInt(record[10], 32))
+	order.VolumeTotal = int32(parseInt(record[11], 32))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse order %s: %w", record[0], err)
+	}
+	return order, nil
+}
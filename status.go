@@ -0,0 +1,36 @@
+package orderbookfetcher
+
+import "time"
+
+// what the fetcher is doing for a single location
+type LocationStatus struct {
+	LocationID   uint64 `json:"locationId"`
+	LocationName string `json:"locationName"`
+	IsCitadel    bool   `json:"isCitadel"`
+	// when is the location going to be fetched or skipped next? (the esi expiry)
+	NextFetch time.Time `json:"nextFetch"`
+	// how often has it been skipped since the last fetch, and in total?
+	Skipped      int  `json:"skipped"`
+	SkippedTotal uint `json:"skippedTotal"`
+	// expiry of the last orderbook written, nil if there is none yet
+	LastSnapshot *time.Time `json:"lastSnapshot,omitempty"`
+	// the last thing that went wrong, empty if nothing did
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// what the fetcher is doing
+type FetcherStatus struct {
+	// when was the fetcher started?
+	Started   time.Time         `json:"started"`
+	Interval  uint              `json:"interval"`
+	Locations []*LocationStatus `json:"locations"`
+	// whose token the citadels are fetched with, nil if there are none
+	Character *Character `json:"character,omitempty"`
+}
+
+// is the fetcher doing its job? if it isn't, the problems say why
+type Readiness struct {
+	Ready    bool     `json:"ready"`
+	Problems []string `json:"problems,omitempty"`
+}
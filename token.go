@@ -0,0 +1,42 @@
+package orderbookfetcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// the sso tokens of the character the citadels are fetched with
+type Token struct {
+	// the latest refresh token, sso rotates them now and then
+	RefreshToken string `json:"refreshToken"`
+	AccessToken  string `json:"accessToken"`
+	// when the access token expires
+	Expiry time.Time `json:"expiry"`
+	// hash of the refreshToken in the configuration the tokens were stored with (see HashRefreshToken),
+	// the configuration takes over again once it has another one
+	ConfigToken string `json:"configToken,omitempty"`
+}
+
+// hash of the refresh token in the configuration, empty if there is none
+func HashRefreshToken(refreshToken string) string {
+	if refreshToken == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// keeps the tokens between runs
+type TokenStore interface {
+	// the stored token, nil if there is none yet
+	LoadToken() (*Token, error)
+	SaveToken(token *Token) error
+}
+
+// the character the tokens belong to, taken from the access token
+type Character struct {
+	ID     uint64   `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
@@ -0,0 +1,250 @@
+package orderbookfetcher
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// region ids are within this range
+	minRegionID = 10000000
+	maxRegionID = 11000000
+	// structure ids start here
+	minStructureID = 1000000000000
+)
+
+// a problem with a single option of the configuration
+type ConfigError struct {
+	// path of the option, e.g. "webhooks[1].url"
+	Field   string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// every problem that has been found in the configuration
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d problem(s) with the configuration:\n  %s", len(e), strings.Join(messages, "\n  "))
+}
+
+// collects the problems while walking the configuration
+type validator struct {
+	errors ConfigErrors
+}
+
+func (v *validator) addf(field, format string, args ...any) {
+	v.errors = append(v.errors, &ConfigError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// the url has to be absolute and use http or https
+func (v *validator) url(field, raw string) {
+	if raw == "" {
+		v.addf(field, "is required")
+		return
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.addf(field, "%q is not an http(s) url", raw)
+	}
+}
+
+// the value has to be a fraction between 0 (inclusive) and 1 (exclusive)
+func (v *validator) fraction(field string, value float64) {
+	if value < 0 || value >= 1 {
+		v.addf(field, "%g has to be a fraction between 0 and 1 (0.036 = 3.6%%)", value)
+	}
+}
+
+// check the configuration for mistakes that would break the fetcher,
+// returns ConfigErrors with every problem that has been found
+func (c *Configuration) Validate() error {
+	v := &validator{}
+
+	if c.Interval < 1 {
+		v.addf("interval", "has to be at least 1 (1 fetches every orderbook, 2 every second one, ...)")
+	}
+
+	// where has a location been listed first?
+	fetched := make(map[uint64]string, len(c.Regions)+len(c.Citadels))
+	for i, location := range c.Regions {
+		field := fmt.Sprintf("regions[%d]", i)
+		if id := location.ID; id < minRegionID || id > maxRegionID {
+			if id >= minStructureID {
+				v.addf(field, "%d is a structure id, did you mean to put it into citadels?", id)
+			} else {
+				v.addf(field, "%d is not a region id (%d-%d)", id, minRegionID, maxRegionID)
+			}
+		}
+		validateLocation(v, field, location, fetched)
+	}
+	for i, location := range c.Citadels {
+		field := fmt.Sprintf("citadels[%d]", i)
+		if id := location.ID; id >= minRegionID && id <= maxRegionID {
+			v.addf(field, "%d is a region id, did you mean to put it into regions?", id)
+		} else if id < minStructureID {
+			v.addf(field, "%d is not a structure id", id)
+		}
+		validateLocation(v, field, location, fetched)
+	}
+	if len(c.Citadels) > 0 {
+		if c.ClientID == "" {
+			v.addf("clientId", "is required to fetch citadels")
+		}
+		// the refresh token can also come from the token file (see the login command)
+		if _, err := os.Stat(c.TokenFileName()); c.RefreshToken == "" && err != nil {
+			v.addf("refreshToken", "is required to fetch citadels, unless %s has been written by the login command", c.TokenFileName())
+		}
+	}
+	v.url("ssoUrl", c.SSOURL)
+	v.url("jwksUrl", c.JWKSURL)
+
+	for i, bucket := range c.CandleBuckets {
+		if bucket <= 0 {
+			v.addf(fmt.Sprintf("candleBuckets[%d]", i), "has to be positive")
+		}
+	}
+	v.fraction("fees.brokerFee", c.Fees.BrokerFee)
+	v.fraction("fees.salesTax", c.Fees.SalesTax)
+
+	for i, id := range c.Arbitrage.Locations {
+		if _, ok := fetched[id]; !ok {
+			v.addf(fmt.Sprintf("arbitrage.locations[%d]", i), "%d isn't in regions or citadels", id)
+		}
+	}
+	if c.Arbitrage.MinVolume < 0 {
+		v.addf("arbitrage.minVolume", "can't be negative")
+	}
+	if c.StationTrading.MinMargin < 0 {
+		v.addf("stationTrading.minMargin", "can't be negative")
+	}
+	v.fraction("stationTrading.competitionBand", c.StationTrading.CompetitionBand)
+
+	for i, entry := range c.Watchlist {
+		field := fmt.Sprintf("watchlist[%d]", i)
+		if _, ok := fetched[entry.Location]; !ok {
+			v.addf(field+".location", "%d isn't in regions or citadels", entry.Location)
+		}
+		if entry.Threshold < 0 {
+			v.addf(field+".threshold", "can't be negative")
+		}
+	}
+
+	for i, webhook := range c.Alerts.Webhooks {
+		v.url(fmt.Sprintf("alerts.webhooks[%d]", i), webhook)
+	}
+	for i, webhook := range c.Webhooks {
+		field := fmt.Sprintf("webhooks[%d]", i)
+		v.url(field+".url", webhook.URL)
+		for j, event := range webhook.Events {
+			switch event {
+			case EventSnapshotCommitted, EventFetchFailed, EventLocationSkipped, EventLocationRemoved, EventTokenRefreshFailed:
+			default:
+				v.addf(fmt.Sprintf("%s.events[%d]", field, j), "unknown event %q", event)
+			}
+		}
+	}
+	v.url("publicUrl", c.PublicURL)
+	for i, chat := range c.Chat {
+		field := fmt.Sprintf("chat[%d]", i)
+		v.url(field+".url", chat.URL)
+		if format := strings.ToLower(chat.Format); format != "" && format != "discord" && format != "slack" {
+			v.addf(field+".format", "has to be discord or slack")
+		}
+	}
+	if c.Staleness < 0 {
+		v.addf("staleness", "can't be negative")
+	}
+	if c.Retention.MaxAge < 0 {
+		v.addf("retention.maxAge", "can't be negative")
+	}
+	if c.Retention.LocationMaxBytes < 0 {
+		v.addf("retention.locationMaxBytes", "can't be negative")
+	}
+	if c.Retention.MaxBytes < 0 {
+		v.addf("retention.maxBytes", "can't be negative")
+	}
+	if c.Retention.Interval <= 0 {
+		v.addf("retention.interval", "has to be positive")
+	}
+
+	for i, addr := range c.Server.Listen {
+		if strings.TrimPrefix(addr, "unix:") == "" {
+			v.addf(fmt.Sprintf("server.listen[%d]", i), "is empty")
+		}
+	}
+	if (c.Server.TLSCert == "") != (c.Server.TLSKey == "") {
+		v.addf("server.tlsCert", "tlsCert and tlsKey have to be set together")
+	}
+	for i, key := range c.Auth.Keys {
+		validateAPIKey(v, fmt.Sprintf("auth.keys[%d]", i), key)
+	}
+
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+// check the overrides of a location and that it hasn't been listed before
+func validateLocation(v *validator, field string, location LocationConfig, fetched map[uint64]string) {
+	if first, ok := fetched[location.ID]; ok {
+		v.addf(field, "%d is already listed at %s", location.ID, first)
+	} else {
+		fetched[location.ID] = field
+	}
+	switch location.Format {
+	case "", FormatCSV, FormatCSVGzip:
+	default:
+		v.addf(field+".format", "has to be %s or %s", FormatCSV, FormatCSVGzip)
+	}
+	if location.MaxAge < 0 {
+		v.addf(field+".maxAge", "can't be negative")
+	}
+	if location.MaxBytes < 0 {
+		v.addf(field+".maxBytes", "can't be negative")
+	}
+	for i, typeID := range location.Types {
+		if typeID <= 0 {
+			v.addf(fmt.Sprintf("%s.types[%d]", field, i), "%d is not a type id", typeID)
+		}
+	}
+}
+
+func validateAPIKey(v *validator, field string, key APIKey) {
+	if key.Name == "" {
+		v.addf(field+".name", "is required")
+	}
+	if b, err := hex.DecodeString(key.Hash); err != nil || len(b) != 32 {
+		v.addf(field+".hash", "has to be a hex encoded sha256, create a key with the key command")
+	}
+	for i, role := range key.Roles {
+		if !ValidRole(role) {
+			v.addf(fmt.Sprintf("%s.roles[%d]", field, i), "unknown role %q", role)
+		}
+	}
+}
+
+// is the role one the api knows about?
+func ValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleRead, RoleReadPublic, RoleReadCitadel:
+		return true
+	}
+	if !strings.HasPrefix(role, "read:") {
+		return false
+	}
+	_, err := strconv.ParseUint(strings.TrimPrefix(role, "read:"), 10, 64)
+	return err == nil
+}
@@ -0,0 +1,134 @@
+package orderbookfetcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// a configuration that passes, with the defaults filled in
+func validConfiguration(t *testing.T) *Configuration {
+	config, err := LoadConfiguration("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Interval = 1
+	config.Regions = []LocationConfig{{ID: 10000002}}
+	config.TokenFile = filepath.Join(t.TempDir(), "token.json")
+	return config
+}
+
+// the fields of the problems, sorted
+func problemFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var problems ConfigErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("expected ConfigErrors, got %T: %s", err, err)
+	}
+	fields := make([]string, len(problems))
+	for i, problem := range problems {
+		fields[i] = problem.Field
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		change func(config *Configuration)
+		// the fields that have problems, sorted
+		fields []string
+	}{
+		{name: "valid", change: func(config *Configuration) {}},
+		{
+			name:   "interval 0",
+			change: func(config *Configuration) { config.Interval = 0 },
+			fields: []string{"interval"},
+		},
+		{
+			name: "citadels without client id and refresh token",
+			change: func(config *Configuration) {
+				config.Citadels = []LocationConfig{{ID: 1035466617946}}
+			},
+			fields: []string{"clientId", "refreshToken"},
+		},
+		{
+			name: "citadels with a refresh token",
+			change: func(config *Configuration) {
+				config.Citadels = []LocationConfig{{ID: 1035466617946}}
+				config.ClientID = "client"
+				config.RefreshToken = "refresh"
+			},
+		},
+		{
+			name: "duplicate region",
+			change: func(config *Configuration) {
+				config.Regions = []LocationConfig{{ID: 10000002}, {ID: 10000043}, {ID: 10000002}}
+			},
+			fields: []string{"regions[2]"},
+		},
+		{
+			name: "ids outside of the region range",
+			change: func(config *Configuration) {
+				config.Regions = []LocationConfig{{ID: 9999999}, {ID: 11000001}, {ID: 1035466617946}}
+			},
+			fields: []string{"regions[0]", "regions[1]", "regions[2]"},
+		},
+		{
+			name: "region in citadels",
+			change: func(config *Configuration) {
+				config.Citadels = []LocationConfig{{ID: 10000002}}
+				config.ClientID = "client"
+				config.RefreshToken = "refresh"
+			},
+			// also listed in regions already
+			fields: []string{"citadels[0]", "citadels[0]"},
+		},
+		{
+			name: "every problem at once",
+			change: func(config *Configuration) {
+				config.Interval = 0
+				config.Regions = []LocationConfig{{ID: 10000002}, {ID: 10000002}, {ID: 42, Format: "xml"}}
+				config.Citadels = []LocationConfig{{ID: 1035466617946}}
+				config.Fees.SalesTax = 3.6
+				config.Webhooks = []WebhookConfig{{URL: "ftp://example.com", Events: []EventType{"snapshot.written"}}}
+				config.Watchlist = []WatchlistEntry{{Location: 10000043, Threshold: -1}}
+			},
+			fields: []string{
+				"clientId", "fees.salesTax", "interval", "refreshToken",
+				"regions[1]", "regions[2]", "regions[2].format",
+				"watchlist[0].location", "watchlist[0].threshold",
+				"webhooks[0].events[0]", "webhooks[0].url",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := validConfiguration(t)
+			test.change(config)
+			fields := problemFields(t, config.Validate())
+			if strings.Join(fields, ",") != strings.Join(test.fields, ",") {
+				t.Errorf("expected problems with %v, got %v", test.fields, fields)
+			}
+		})
+	}
+}
+
+func TestValidateTokenFile(t *testing.T) {
+	config := validConfiguration(t)
+	config.Citadels = []LocationConfig{{ID: 1035466617946}}
+	config.ClientID = "client"
+	if err := os.WriteFile(config.TokenFile, []byte(`{"refreshToken": "refresh"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the login command has written the token file
+	if err := config.Validate(); err != nil {
+		t.Errorf("expected the token file to do instead of refreshToken, got %s", err)
+	}
+}